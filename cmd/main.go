@@ -2,18 +2,30 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"github.com/cenkalti/backoff/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/yuridevx/proxylist/domain"
+	"github.com/yuridevx/proxylist/pkg/admin"
 	"github.com/yuridevx/proxylist/pkg/config"
 	"github.com/yuridevx/proxylist/pkg/dedup"
+	"github.com/yuridevx/proxylist/pkg/dnsjudge"
+	"github.com/yuridevx/proxylist/pkg/judge"
+	"github.com/yuridevx/proxylist/pkg/netlist"
 	"github.com/yuridevx/proxylist/pkg/providers"
+	"github.com/yuridevx/proxylist/pkg/proxypool"
 	"github.com/yuridevx/proxylist/pkg/proxytest"
+	"github.com/yuridevx/proxylist/pkg/quarantine"
+	"github.com/yuridevx/proxylist/pkg/queue"
 	"github.com/yuridevx/proxylist/pkg/reconciler"
+	"github.com/yuridevx/proxylist/pkg/stats"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"net"
 	"os"
 	"os/signal"
+	"slices"
 	"syscall"
+	"time"
 )
 
 func initializeLogger(conf *config.Config) (*zap.Logger, error) {
@@ -40,6 +52,56 @@ func initializeLogger(conf *config.Config) (*zap.Logger, error) {
 	return logConfig.Build()
 }
 
+// loadBlocklist reads the honeypot blocklists and the ASN database they may need.
+func loadBlocklist(conf config.HoneypotConfig) (*netlist.List, error) {
+	var db *netlist.ASNDB
+	if conf.ASNDatabase != "" {
+		var err error
+		if db, err = netlist.LoadASNDB(conf.ASNDatabase); err != nil {
+			return nil, err
+		}
+	}
+	return netlist.Load(conf.Blocklists, db)
+}
+
+// checkProfiles converts the configured check profiles.
+func checkProfiles(conf map[string]config.ProfileConfig) (map[string]proxytest.Profile, error) {
+	profiles := make(map[string]proxytest.Profile, len(conf))
+	for name, pc := range conf {
+		prof := proxytest.Profile{
+			Name:          name,
+			Timeout:       pc.Timeout,
+			SkipWebSocket: pc.SkipWebSocket,
+			SkipFetch:     pc.SkipFetch,
+			FetchURL:      pc.FetchURL,
+			RequireFetch:  pc.RequireFetch,
+			SkipExtras:    pc.SkipExtras,
+		}
+		for _, protocol := range pc.Protocols {
+			p, err := proxytest.ParseProtocol(protocol)
+			if err != nil {
+				return nil, fmt.Errorf("profile %s: %w", name, err)
+			}
+			prof.Protocols = prof.Protocols.With(p)
+		}
+		profiles[name] = prof
+	}
+	return profiles, nil
+}
+
+// newAddressFilter builds the filter applied to every provided address.
+func newAddressFilter(conf config.AddressFilterConfig) (*netlist.Filter, error) {
+	allow, err := netlist.New(conf.Allow, nil)
+	if err != nil {
+		return nil, err
+	}
+	deny, err := netlist.New(conf.Deny, nil)
+	if err != nil {
+		return nil, err
+	}
+	return netlist.NewFilter(allow, deny, conf.AllowReserved), nil
+}
+
 func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
@@ -56,36 +118,232 @@ func main() {
 		panic(err)
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "stats" {
+		if err := printProviderStats(ctx, db); err != nil {
+			panic(err)
+		}
+		return
+	}
+
 	de, err := dedup.NewDefault()
 	if err != nil {
 		panic(err)
 	}
 
-	var sink = make(chan domain.ProvidedProxy)
-	var proxyProviders []domain.ProxyProvider
+	collector := stats.NewCollector(db, logger)
+	reconciler.RunReconciler(ctx, collector.Flush, reconciler.WithInterval(time.Minute, 0))
+
+	testQueue := queue.New(de, conf.QueueCapacity)
+	go testQueue.Run(ctx)
+
+	addressFilter, err := newAddressFilter(conf.AddressFilter)
+	if err != nil {
+		panic(err)
+	}
 
-	for _, urlSource := range conf.UrlSourceList {
-		proxyProviders = append(proxyProviders, providers.NewUrlProxyList(urlSource))
+	providerOpts := []providers.Option{
+		providers.WithStats(collector),
+		providers.WithAddressFilter(addressFilter),
+		providers.WithMaxListSize(conf.MaxListSize),
 	}
-	for _, hostPortSource := range conf.HostPortSourceList {
-		proxyProviders = append(proxyProviders, providers.NewHostPortList(hostPortSource))
+	if conf.ConditionalFetch {
+		providerOpts = append(providerOpts, providers.WithSourceCache(de), providers.WithDiffOnly(conf.DiffOnly))
 	}
 
-	for _, prov := range proxyProviders {
-		prov.Init(logger, sink)
-		reconciler.RunReconciler(ctx, prov.Reconcile)
+	providerConfigs := conf.ProviderConfigs()
+
+	var proxyPool *proxypool.Pool
+	if slices.ContainsFunc(providerConfigs, func(pc config.ProviderConfig) bool { return pc.FetchViaProxy }) {
+		proxyPool = proxypool.NewPool(db, logger, 8*time.Hour, 200)
+		_ = proxyPool.Refresh(ctx)
+		reconciler.RunReconciler(ctx, proxyPool.Refresh, reconciler.WithInterval(10*time.Minute, time.Minute))
+	}
+
+	guards := &quarantine.Registry{}
+	runners := &reconciler.Registry{}
+	names := make(map[string]bool)
+	for _, pc := range providerConfigs {
+		if !pc.IsEnabled() {
+			continue
+		}
+		// stats, quarantine, queue lanes and triggers are all keyed by name
+		name := providers.Name(pc)
+		if names[name] {
+			logger.Error("Duplicate provider name, set a unique name", zap.String("source", pc.Source), zap.String("name", name))
+			continue
+		}
+		names[name] = true
+
+		opts := slices.Clip(providerOpts)
+		if pc.FetchViaProxy {
+			opts = append(opts, providers.WithFetchVia(proxyPool))
+		}
+		prov, err := providers.New(pc, opts...)
+		if err != nil {
+			logger.Error("Invalid provider", zap.String("source", pc.Source), zap.Error(err))
+			continue
+		}
+		prov.Init(logger.With(zap.String("source", pc.Source), zap.Strings("tags", pc.Tags)), testQueue.Input(ctx, name))
+
+		var interval backoff.BackOff = &reconciler.JitterBackOff{Interval: pc.Interval, Jitter: pc.Jitter}
+		runnerOpts := []reconciler.RunnerOption{
+			reconciler.WithWaitBackOff(interval),
+			reconciler.WithStartupJitter(pc.Jitter),
+			reconciler.WithWaitFirst(pc.WaitFirst),
+		}
+		if pc.Cron != "" {
+			schedule, err := reconciler.NewScheduleBackOff(pc.Cron)
+			if err != nil {
+				logger.Error("Invalid provider cron", zap.String("source", pc.Source), zap.Error(err))
+				continue
+			}
+			// the guard stretches the schedule by skipping ticks
+			interval = schedule
+			runnerOpts = append(runnerOpts, reconciler.WithSchedule(schedule))
+		}
+
+		reconcile := prov.Reconcile
+		if conf.Quarantine.Enabled {
+			guard := quarantine.NewGuard(
+				name,
+				conf.Quarantine,
+				collector,
+				logger,
+				interval,
+			)
+			guards.Add(guard)
+			reconcile = guard.Wrap(reconcile)
+			runnerOpts = append(runnerOpts, guard.Options()...)
+		}
+		runners.Add(name, pc.Tags, reconciler.RunReconciler(ctx, reconcile, runnerOpts...))
+	}
+
+	checkIn := testQueue.Out()
+	if conf.Prefilter.IsEnabled() {
+		preFilter := proxytest.NewPreFilter(checkIn, logger, db, de, collector, conf.Prefilter.Workers, conf.Prefilter.Timeout)
+		preFilter.Start(ctx)
+		checkIn = preFilter.Out()
+	}
+
+	sinkOpts := []proxytest.SinkOption{proxytest.WithStats(collector), proxytest.WithLatencySamples(conf.LatencySamples)}
+	var limits *proxytest.HostLimits
+	if len(conf.RateLimits) > 0 {
+		limits = proxytest.NewHostLimits(conf.RateLimits)
+		sinkOpts = append(sinkOpts, proxytest.WithRateLimits(limits))
+	}
+	if conf.Bandwidth.Enabled {
+		sinkOpts = append(sinkOpts, proxytest.WithBandwidth(&proxytest.BandwidthTest{
+			DownloadURL: conf.Bandwidth.DownloadURL,
+			UploadURL:   conf.Bandwidth.UploadURL,
+			UploadSize:  conf.Bandwidth.UploadSize,
+		}))
+	}
+	if conf.WSStability.Enabled {
+		sinkOpts = append(sinkOpts, proxytest.WithWSStability(&proxytest.WSStabilityTest{
+			Duration: conf.WSStability.Duration,
+			Interval: conf.WSStability.Interval,
+		}))
+	}
+	if conf.ConnectPorts.Enabled {
+		sinkOpts = append(sinkOpts, proxytest.WithConnectPorts(&proxytest.ConnectPortsTest{
+			Host:  conf.ConnectPorts.Host,
+			Ports: conf.ConnectPorts.Ports,
+			Echo:  conf.ConnectPorts.Echo,
+		}))
+	}
+	if conf.HTTPVersions.Enabled {
+		sinkOpts = append(sinkOpts, proxytest.WithHTTPVersions(&proxytest.HTTPVersionsTest{
+			HTTP2URL: conf.HTTPVersions.HTTP2URL,
+			HTTP3URL: conf.HTTPVersions.HTTP3URL,
+		}))
+	}
+	if conf.DNSJudge.Enabled {
+		dnsJudge, err := dnsjudge.New(conf.DNSJudge.Zone, net.ParseIP(conf.DNSJudge.AnswerIP), conf.DNSJudge.Listen, conf.DNSJudge.HTTPPort, logger)
+		if err == nil {
+			err = dnsJudge.Start(ctx)
+		}
+		if err != nil {
+			logger.Error("dns judge unavailable", zap.Error(err))
+		} else {
+			if err := dnsJudge.LearnLocal(ctx); err != nil {
+				logger.Warn("could not learn local dns resolvers, only socks4 counts as a leak", zap.Error(err))
+			}
+			sinkOpts = append(sinkOpts, proxytest.WithDNSJudge(dnsJudge))
+		}
+	}
+	if conf.Honeypot.Enabled {
+		blocklist, err := loadBlocklist(conf.Honeypot)
+		if err != nil {
+			panic(err)
+		}
+		sinkOpts = append(sinkOpts, proxytest.WithHoneypot(&proxytest.HoneypotTest{Blocklist: blocklist}))
+	}
+	var judges *judge.Watchdog
+	if conf.Judges.Enabled {
+		judges = judge.New(judge.Candidates{
+			Get:       conf.Judges.Get,
+			IP:        conf.Judges.IP,
+			WebSocket: conf.Judges.WebSocket,
+			Fetch:     conf.Judges.Fetch,
+		}, conf.Judges.Timeout, logger,
+			judge.WithLimits(limits),
+			judge.WithFetchInterval(conf.Judges.FetchInterval),
+		)
+		reconciler.RunReconciler(ctx, judges.Probe,
+			reconciler.WithInterval(conf.Judges.Interval, 0),
+			reconciler.WithFailBackOff(&reconciler.JitterBackOff{Interval: conf.Judges.Interval}),
+		)
+		sinkOpts = append(sinkOpts, proxytest.WithJudges(judges))
+	}
+	if len(conf.Profiles) > 0 {
+		profiles, err := checkProfiles(conf.Profiles)
+		if err != nil {
+			panic(err)
+		}
+		sinkOpts = append(sinkOpts, proxytest.WithProfiles(profiles, conf.RevalidateProfile))
+	}
+	if conf.Concurrency.Adaptive {
+		sinkOpts = append(sinkOpts, proxytest.WithAdaptiveConcurrency(conf.Concurrency))
 	}
 
 	proxySink := proxytest.NewProxySink(
-		sink,
+		checkIn,
 		logger,
 		db,
 		de,
 		conf.FetchItemUrl,
 		conf.ParallelTests,
 		conf.ProxyTimeoutS,
+		sinkOpts...,
 	)
 	proxySink.Start(ctx)
 
-	<-ctx.Done()
+	if conf.AdminAddr != "" {
+		adminServer := admin.NewServer(conf.AdminAddr, logger, db,
+			admin.WithStats(collector),
+			admin.WithQuarantine(guards),
+			admin.WithRunners(runners),
+			admin.WithRetestSink(testQueue.Input(ctx, "admin")),
+			admin.WithQueue(testQueue),
+			admin.WithJudges(judges),
+			admin.WithAddressFilter(addressFilter),
+			admin.WithToken(conf.AdminToken),
+		)
+		go func() {
+			if err := adminServer.Run(ctx); err != nil {
+				logger.Error("admin api failed", zap.Error(err))
+			}
+		}()
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			logger.Info("SIGHUP received, reconciling all providers", zap.Int("providers", runners.TriggerAll()))
+		}
+	}
 }
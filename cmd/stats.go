@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yuridevx/proxylist/pkg/stats"
+)
+
+// printProviderStats writes the persisted provider statistics as a table.
+func printProviderStats(ctx context.Context, db *pgxpool.Pool) error {
+	list, err := stats.List(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PROVIDER\tLAST FETCH\tDURATION\tSTATUS\tPARSED\tFAILED\tREJECTED\tNEW\tCHECKED\tPASSED\tYIELD\tERROR")
+	for _, p := range list {
+		lastFetch := "-"
+		if p.LastFetchAt.Valid {
+			lastFetch = p.LastFetchAt.Time.Format(time.DateTime)
+		}
+		yield := "-"
+		if p.Checked > 0 {
+			yield = fmt.Sprintf("%.1f%%", float64(p.Passed)*100/float64(p.Checked))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%dms\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%s\t%s\n",
+			p.Provider,
+			lastFetch,
+			p.FetchDurationMs.Int32,
+			p.HttpStatus.Int32,
+			p.EntriesParsed.Int32,
+			p.ParseFailures.Int32,
+			p.EntriesRejected.Int32,
+			p.UniqueNew,
+			p.Checked,
+			p.Passed,
+			yield,
+			p.FetchError.String,
+		)
+	}
+	return w.Flush()
+}
@@ -11,6 +11,12 @@ type ProvidedProxy struct {
 	IP       string
 	Port     int
 	Provider string
+	// Priority comes from the provider configuration, higher is more important.
+	Priority int
+	// Retest forces a check even if the proxy was tested recently.
+	Retest bool
+	// Profile names the check profile to run, empty runs the default checks.
+	Profile string
 }
 
 // Key serializes a proxy to a unique string
@@ -0,0 +1,359 @@
+package admin
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yuridevx/proxylist/domain"
+	"github.com/yuridevx/proxylist/pkg/judge"
+	"github.com/yuridevx/proxylist/pkg/netlist"
+	"github.com/yuridevx/proxylist/pkg/providers"
+	"github.com/yuridevx/proxylist/pkg/quarantine"
+	"github.com/yuridevx/proxylist/pkg/queue"
+	"github.com/yuridevx/proxylist/pkg/reconciler"
+	"github.com/yuridevx/proxylist/pkg/stats"
+	"go.uber.org/zap"
+)
+
+// retestProvider is the provider name attached to manually queued proxies.
+const retestProvider = "admin"
+
+const (
+	// maxRetestBody caps the body of a retest request.
+	maxRetestBody = 1 << 20
+	// maxRetestBatches bounds the retest requests still being queued.
+	maxRetestBatches = 4
+)
+
+// Server is the admin HTTP API.
+type Server struct {
+	addr    string
+	log     *zap.Logger
+	db      *pgxpool.Pool
+	stats   *stats.Collector
+	guards  *quarantine.Registry
+	runners *reconciler.Registry
+	sink    chan<- domain.ProvidedProxy
+	queue   *queue.Queue
+	judges  *judge.Watchdog
+	filter  *netlist.Filter
+	token   string
+	retests chan struct{}
+	mux     *http.ServeMux
+	ctx     context.Context
+}
+
+// Option enables a group of admin routes.
+type Option func(*Server)
+
+// WithStats serves live provider statistics.
+func WithStats(collector *stats.Collector) Option {
+	return func(s *Server) {
+		s.stats = collector
+	}
+}
+
+// WithQuarantine serves the quarantine state of providers.
+func WithQuarantine(guards *quarantine.Registry) Option {
+	return func(s *Server) {
+		s.guards = guards
+	}
+}
+
+// WithRunners serves provider run state and manual reconcile triggers.
+func WithRunners(runners *reconciler.Registry) Option {
+	return func(s *Server) {
+		s.runners = runners
+	}
+}
+
+// WithRetestSink accepts proxies to retest immediately and queues them into sink.
+func WithRetestSink(sink chan<- domain.ProvidedProxy) Option {
+	return func(s *Server) {
+		s.sink = sink
+	}
+}
+
+// WithQueue serves the depth of the test queue.
+func WithQueue(q *queue.Queue) Option {
+	return func(s *Server) {
+		s.queue = q
+	}
+}
+
+// WithJudges serves the health of the judges. A nil watchdog serves nothing.
+func WithJudges(w *judge.Watchdog) Option {
+	return func(s *Server) {
+		s.judges = w
+	}
+}
+
+// WithAddressFilter drops retest entries whose address the filter rejects,
+// the same way the providers drop them.
+func WithAddressFilter(f *netlist.Filter) Option {
+	return func(s *Server) {
+		s.filter = f
+	}
+}
+
+// WithToken requires the routes that change state to carry the token as a
+// bearer token. Without a token they only answer loopback clients.
+func WithToken(token string) Option {
+	return func(s *Server) {
+		s.token = token
+	}
+}
+
+func NewServer(addr string, log *zap.Logger, db *pgxpool.Pool, options ...Option) *Server {
+	s := &Server{
+		addr:    addr,
+		log:     log,
+		db:      db,
+		retests: make(chan struct{}, maxRetestBatches),
+		mux:     http.NewServeMux(),
+		ctx:     context.Background(),
+	}
+	for _, option := range options {
+		option(s)
+	}
+
+	s.mux.HandleFunc("GET /providers/stats", s.providerStats)
+	if s.stats != nil {
+		s.mux.HandleFunc("GET /providers/stats/live", s.providerStatsLive)
+		s.mux.HandleFunc("GET /checks/failures", s.checkFailures)
+	}
+	if s.guards != nil {
+		s.mux.HandleFunc("GET /providers/quarantine", s.providerQuarantine)
+	}
+	if s.runners != nil {
+		s.mux.HandleFunc("GET /providers", s.providerList)
+		s.mux.HandleFunc("POST /providers/reconcile", s.authorized(s.reconcileAll))
+		s.mux.HandleFunc("POST /providers/{name}/reconcile", s.authorized(s.reconcileOne))
+	}
+	if s.queue != nil {
+		s.mux.HandleFunc("GET /queue", s.queueDepth)
+	}
+	if s.judges != nil {
+		s.mux.HandleFunc("GET /judges", s.judgeStatus)
+	}
+	if s.sink != nil {
+		s.mux.HandleFunc("POST /proxies/retest", s.authorized(s.retest))
+	}
+	return s
+}
+
+// Run serves until ctx is done.
+func (s *Server) Run(ctx context.Context) error {
+	s.ctx = ctx
+	srv := &http.Server{Addr: s.addr, Handler: s.mux}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	s.log.Info("admin api listening", zap.String("addr", s.addr))
+	err := srv.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// authorized lets a request through when it carries the token, or, without
+// a token configured, when it comes from a loopback address.
+func (s *Server) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.token != "" {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		} else if !loopback(r.RemoteAddr) {
+			http.Error(w, "forbidden without admin_token", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func loopback(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// providerStats returns the persisted statistics of every provider.
+func (s *Server) providerStats(w http.ResponseWriter, r *http.Request) {
+	list, err := stats.List(r.Context(), s.db)
+	if err != nil {
+		s.log.Error("listing provider stats failed", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, list)
+}
+
+// providerStatsLive returns the statistics collected since process start.
+func (s *Server) providerStatsLive(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.stats.Snapshot())
+}
+
+// checkFailures returns the failed check counts per protocol and error
+// class. Mostly refused and timeout is dead proxies, judge or bad_gateway
+// across every protocol points at the judge.
+func (s *Server) checkFailures(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.stats.Failures())
+}
+
+// judgeStatus returns the last probe of every judge.
+func (s *Server) judgeStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.judges.Statuses())
+}
+
+// providerQuarantine returns the quarantine state of every guarded provider.
+func (s *Server) providerQuarantine(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.guards.Statuses())
+}
+
+// providerList returns every provider with its last and next run.
+func (s *Server) providerList(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.runners.States())
+}
+
+// queueDepth returns the number of queued proxies per provider.
+func (s *Server) queueDepth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.queue.Depths())
+}
+
+// reconcileAll triggers an immediate reconcile of every provider.
+func (s *Server) reconcileAll(w http.ResponseWriter, r *http.Request) {
+	n := s.runners.TriggerAll()
+	s.log.Info("manual reconcile of all providers", zap.Int("providers", n))
+	writeJSON(w, map[string]int{"triggered": n})
+}
+
+// reconcileOne triggers an immediate reconcile of the providers with the given name or tag.
+// Slashes in names, as in the host and path of unnamed sources, must be escaped.
+func (s *Server) reconcileOne(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	n := s.runners.Trigger(name)
+	if n == 0 {
+		http.Error(w, "unknown provider", http.StatusNotFound)
+		return
+	}
+	s.log.Info("manual reconcile", zap.String("provider", name), zap.Int("providers", n))
+	writeJSON(w, map[string]int{"triggered": n})
+}
+
+// retest queues the proxies in the request body for an immediate check,
+// bypassing deduplication. The body is either a JSON array of strings or
+// one proxy per line in any format the file provider understands. The
+// profile query parameter picks the check profile. Addresses the address
+// filter rejects are reported back and not queued. Bodies over
+// maxRetestBody are refused, as are requests while maxRetestBatches
+// earlier ones are still being queued.
+func (s *Server) retest(w http.ResponseWriter, r *http.Request) {
+	started := time.Now()
+	var lines []string
+	body := http.MaxBytesReader(w, r.Body, maxRetestBody)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(body).Decode(&lines); err != nil {
+			http.Error(w, err.Error(), bodyStatus(err))
+			return
+		}
+	} else {
+		scanner := bufio.NewScanner(body)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			http.Error(w, err.Error(), bodyStatus(err))
+			return
+		}
+	}
+
+	var queue []domain.ProvidedProxy
+	invalid := []string{}
+	rejected := []string{}
+	parsed := 0
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		ip, port, err := providers.ParseEntry(line)
+		if err != nil {
+			invalid = append(invalid, line)
+			continue
+		}
+		parsed++
+		if _, ok := s.filter.Allowed(ip); !ok {
+			rejected = append(rejected, line)
+			continue
+		}
+		queue = append(queue, domain.ProvidedProxy{
+			IP:       ip,
+			Port:     port,
+			Provider: retestProvider,
+			Retest:   true,
+			Profile:  r.URL.Query().Get("profile"),
+		})
+	}
+
+	select {
+	case s.retests <- struct{}{}:
+	default:
+		http.Error(w, "too many retests being queued", http.StatusServiceUnavailable)
+		return
+	}
+	// the sink may be busy for a while, so queue in the background
+	go func() {
+		defer func() { <-s.retests }()
+		for _, p := range queue {
+			select {
+			case <-s.ctx.Done():
+				return
+			case s.sink <- p:
+			}
+		}
+	}()
+
+	s.stats.RecordFetch(stats.Fetch{
+		Provider:      retestProvider,
+		Started:       started,
+		Duration:      time.Since(started),
+		Parsed:        parsed,
+		ParseFailures: len(invalid),
+		Rejected:      len(rejected),
+	})
+	s.log.Info("manual retest", zap.Int("queued", len(queue)), zap.Int("invalid", len(invalid)), zap.Int("rejected", len(rejected)))
+	writeJSON(w, map[string]any{"queued": len(queue), "invalid": invalid, "rejected": rejected})
+}
+
+// bodyStatus tells a body over the size limit from a malformed one.
+func bodyStatus(err error) int {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
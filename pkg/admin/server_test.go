@@ -0,0 +1,68 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/yuridevx/proxylist/domain"
+	"go.uber.org/zap"
+)
+
+func retestRequest(remote, token, body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/proxies/retest", strings.NewReader(body))
+	r.RemoteAddr = remote
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	return r
+}
+
+func TestRetestAuthorization(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string
+		remote string
+		sent   string
+		status int
+	}{
+		{"loopback without token", "", "127.0.0.1:5000", "", http.StatusOK},
+		{"ipv6 loopback without token", "", "[::1]:5000", "", http.StatusOK},
+		{"remote without token", "", "203.0.113.5:5000", "", http.StatusForbidden},
+		{"remote with token", "secret", "203.0.113.5:5000", "secret", http.StatusOK},
+		{"wrong token", "secret", "127.0.0.1:5000", "guess", http.StatusUnauthorized},
+		{"missing token", "secret", "127.0.0.1:5000", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		sink := make(chan domain.ProvidedProxy, 1)
+		s := NewServer("", zap.NewNop(), nil, WithRetestSink(sink), WithToken(tt.token))
+		w := httptest.NewRecorder()
+		s.mux.ServeHTTP(w, retestRequest(tt.remote, tt.sent, "1.1.1.1:80\n"))
+		if w.Code != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.status)
+		}
+	}
+}
+
+func TestRetestLimits(t *testing.T) {
+	// an unbuffered sink nobody reads keeps every batch pending
+	s := NewServer("", zap.NewNop(), nil, WithRetestSink(make(chan domain.ProvidedProxy)))
+	serve := func(body string) int {
+		w := httptest.NewRecorder()
+		s.mux.ServeHTTP(w, retestRequest("127.0.0.1:5000", "", body))
+		return w.Code
+	}
+
+	if code := serve(strings.Repeat("1.1.1.1:80\n", maxRetestBody/10)); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized body: status %d, want %d", code, http.StatusRequestEntityTooLarge)
+	}
+	for i := 0; i < maxRetestBatches; i++ {
+		if code := serve("1.1.1.1:80\n"); code != http.StatusOK {
+			t.Fatalf("batch %d: status %d", i, code)
+		}
+	}
+	if code := serve("1.1.1.1:80\n"); code != http.StatusServiceUnavailable {
+		t.Errorf("batch over the limit: status %d, want %d", code, http.StatusServiceUnavailable)
+	}
+}
@@ -1,22 +1,219 @@
 package config
 
 import (
+	"cmp"
 	"gopkg.in/yaml.v3"
 	"os"
 	"path/filepath"
 	"reflect"
+	"time"
 )
 
+// Provider types accepted in ProviderConfig.Type.
+const (
+	ProviderHostPort = "host_port"
+	ProviderUrl      = "url"
+	ProviderFile     = "file"
+)
+
+// ProviderConfig describes a single proxy source and its schedule.
+type ProviderConfig struct {
+	Name          string            `yaml:"name"`
+	Type          string            `yaml:"type"`
+	Source        string            `yaml:"source"`
+	Interval      time.Duration     `yaml:"interval"`
+	Jitter        time.Duration     `yaml:"jitter"`
+	Cron          string            `yaml:"cron"`
+	WaitFirst     bool              `yaml:"wait_first"`
+	Timeout       time.Duration     `yaml:"timeout"`
+	Headers       map[string]string `yaml:"headers"`
+	FetchViaProxy bool              `yaml:"fetch_via_proxy"`
+	Enabled       *bool             `yaml:"enabled"`
+	Tags          []string          `yaml:"tags"`
+	Priority      int               `yaml:"priority"`
+	Profile       string            `yaml:"profile"`
+}
+
+// IsEnabled reports whether the provider should run. Providers are enabled unless disabled explicitly.
+func (pc ProviderConfig) IsEnabled() bool {
+	return pc.Enabled == nil || *pc.Enabled
+}
+
+// QuarantineConfig controls when providers are slowed down or quarantined.
+type QuarantineConfig struct {
+	Enabled       bool          `yaml:"enabled"`
+	MinChecked    int           `yaml:"min_checked"`
+	MinYield      float64       `yaml:"min_yield"`
+	MaxFailures   int           `yaml:"max_failures"`
+	Multiplier    float64       `yaml:"multiplier"`
+	MaxSlowdowns  int           `yaml:"max_slowdowns"`
+	ProbeInterval time.Duration `yaml:"probe_interval"`
+}
+
+// PrefilterConfig controls the TCP connect stage run before full proxy checks.
+type PrefilterConfig struct {
+	Enabled *bool         `yaml:"enabled"`
+	Workers int           `yaml:"workers"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// IsEnabled reports whether the pre-filter runs. It is enabled unless disabled explicitly.
+func (pc PrefilterConfig) IsEnabled() bool {
+	return pc.Enabled == nil || *pc.Enabled
+}
+
+// ConcurrencyConfig bounds the adaptive number of ProxySink workers and the
+// resource pressure at which it backs off.
+type ConcurrencyConfig struct {
+	Adaptive        bool          `yaml:"adaptive"`
+	Min             int           `yaml:"min"`
+	Max             int           `yaml:"max"`
+	Interval        time.Duration `yaml:"interval"`
+	MaxFDRatio      float64       `yaml:"max_fd_ratio"`
+	MaxGoroutines   int           `yaml:"max_goroutines"`
+	MaxTimeoutRatio float64       `yaml:"max_timeout_ratio"`
+	MaxCPU          float64       `yaml:"max_cpu"`
+	// TimeoutWindows is the number of consecutive intervals the timeout
+	// ratio must stay over MaxTimeoutRatio before it counts as pressure, so
+	// a batch of dead proxies does not shrink the limit on its own.
+	TimeoutWindows int `yaml:"timeout_windows"`
+}
+
+// RateLimit is a token bucket refilled with Rate requests per second. A
+// Rate of zero or less leaves the host unlimited.
+type RateLimit struct {
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+// BandwidthConfig enables the throughput test of working proxies. Upload
+// only runs when UploadURL is set.
+type BandwidthConfig struct {
+	Enabled     bool   `yaml:"enabled"`
+	DownloadURL string `yaml:"download_url"`
+	UploadURL   string `yaml:"upload_url"`
+	UploadSize  int    `yaml:"upload_size"`
+}
+
+// WSStabilityConfig enables the long lived websocket test of proxies whose
+// websocket check passed.
+type WSStabilityConfig struct {
+	Enabled  bool          `yaml:"enabled"`
+	Duration time.Duration `yaml:"duration"`
+	Interval time.Duration `yaml:"interval"`
+}
+
+// ConnectPortsConfig enables the tunnel port test of working proxies. Host
+// must accept connections on every port, and echo them back when Echo is set.
+type ConnectPortsConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Host    string `yaml:"host"`
+	Ports   []int  `yaml:"ports"`
+	Echo    bool   `yaml:"echo"`
+}
+
+// HTTPVersionsConfig enables the HTTP/2 and HTTP/3 checks of working
+// proxies. HTTP3URL must be served over QUIC.
+type HTTPVersionsConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	HTTP2URL string `yaml:"http2_url"`
+	HTTP3URL string `yaml:"http3_url"`
+}
+
+// DNSJudgeConfig runs a DNS stand-in for Zone, which must be delegated to
+// this host at AnswerIP. Listen is the UDP address of the DNS server and
+// HTTPPort the port the judged requests go to.
+type DNSJudgeConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	Zone     string `yaml:"zone"`
+	AnswerIP string `yaml:"answer_ip"`
+	Listen   string `yaml:"listen"`
+	HTTPPort int    `yaml:"http_port"`
+}
+
+// HoneypotConfig enables the honeypot classifier of working proxies.
+// Blocklists are files of CIDRs, addresses or AS numbers; AS entries need
+// ASNDatabase, an iptoasn.com style TSV file.
+type HoneypotConfig struct {
+	Enabled     bool     `yaml:"enabled"`
+	Blocklists  []string `yaml:"blocklists"`
+	ASNDatabase string   `yaml:"asn_database"`
+}
+
+// AddressFilterConfig limits the proxy addresses providers may feed into
+// the checker. Private, loopback, link-local, multicast and other reserved
+// ranges are rejected unless covered by Allow or AllowReserved is set. Deny
+// always wins. Entries are CIDRs or single addresses.
+type AddressFilterConfig struct {
+	Allow         []string `yaml:"allow"`
+	Deny          []string `yaml:"deny"`
+	AllowReserved bool     `yaml:"allow_reserved"`
+}
+
+// JudgesConfig enables the judge watchdog. Every list is in failover
+// order; Get and IP default to httpbin, WebSocket to echo.websocket.org and
+// Fetch to FetchItemUrl. The fetch judges are probed only every
+// FetchInterval, as they are usually the site we want to spare.
+type JudgesConfig struct {
+	Enabled       bool          `yaml:"enabled"`
+	Get           []string      `yaml:"get"`
+	IP            []string      `yaml:"ip"`
+	WebSocket     []string      `yaml:"websocket"`
+	Fetch         []string      `yaml:"fetch"`
+	Interval      time.Duration `yaml:"interval"`
+	FetchInterval time.Duration `yaml:"fetch_interval"`
+	Timeout       time.Duration `yaml:"timeout"`
+}
+
+// ProfileConfig is a named set of checks. Zero fields keep the full
+// pipeline: every protocol, the websocket and fetch checks and the enabled
+// optional measurements, with the global timeout.
+type ProfileConfig struct {
+	Protocols     []string      `yaml:"protocols"`
+	Timeout       time.Duration `yaml:"timeout"`
+	SkipWebSocket bool          `yaml:"skip_websocket"`
+	SkipFetch     bool          `yaml:"skip_fetch"`
+	FetchURL      string        `yaml:"fetch_url"`
+	RequireFetch  bool          `yaml:"require_fetch"`
+	SkipExtras    bool          `yaml:"skip_extras"`
+}
+
 type Config struct {
-	DSN                string   `yaml:"dsn"`
-	ZapProduction      bool     `yaml:"zap_production"`
-	ZapLogLevel        string   `yaml:"zap_log_level"`
-	ParallelTests      int      `yaml:"parallel_tests"`
-	FetchItemUrl       string   `yaml:"fetch_item_url"`
-	ProxyTimeoutS      int      `yaml:"proxy_timeout_s"`
-	HostPortSourceList []string `yaml:"host_port_source_list"`
-	UrlSourceList      []string `yaml:"url_source_list"`
-	UseDBProxy         bool     `yaml:"use_db_proxy"`
+	DSN                string               `yaml:"dsn"`
+	ZapProduction      bool                 `yaml:"zap_production"`
+	ZapLogLevel        string               `yaml:"zap_log_level"`
+	ParallelTests      int                  `yaml:"parallel_tests"`
+	FetchItemUrl       string               `yaml:"fetch_item_url"`
+	ProxyTimeoutS      int                  `yaml:"proxy_timeout_s"`
+	HostPortSourceList []string             `yaml:"host_port_source_list"`
+	UrlSourceList      []string             `yaml:"url_source_list"`
+	FileSourceList     []string             `yaml:"file_source_list"`
+	Providers          []ProviderConfig     `yaml:"providers"`
+	UseDBProxy         bool                 `yaml:"use_db_proxy"`
+	ConditionalFetch   bool                 `yaml:"conditional_fetch"`
+	DiffOnly           bool                 `yaml:"diff_only"`
+	MaxListSize        int64                `yaml:"max_list_size"`
+	AdminAddr          string               `yaml:"admin_addr"`
+	AdminToken         string               `yaml:"admin_token"`
+	Quarantine         QuarantineConfig     `yaml:"quarantine"`
+	QueueCapacity      int                  `yaml:"queue_capacity"`
+	Prefilter          PrefilterConfig      `yaml:"prefilter"`
+	Concurrency        ConcurrencyConfig    `yaml:"concurrency"`
+	RateLimits         map[string]RateLimit `yaml:"rate_limits"`
+	LatencySamples     int                  `yaml:"latency_samples"`
+	Bandwidth          BandwidthConfig      `yaml:"bandwidth"`
+	WSStability        WSStabilityConfig    `yaml:"ws_stability"`
+	ConnectPorts       ConnectPortsConfig   `yaml:"connect_ports"`
+	HTTPVersions       HTTPVersionsConfig   `yaml:"http_versions"`
+	DNSJudge           DNSJudgeConfig       `yaml:"dns_judge"`
+	Honeypot           HoneypotConfig       `yaml:"honeypot"`
+	AddressFilter      AddressFilterConfig  `yaml:"address_filter"`
+	Judges             JudgesConfig         `yaml:"judges"`
+
+	// Profiles are the named check profiles, RevalidateProfile the one
+	// for proxies that were checked before.
+	Profiles          map[string]ProfileConfig `yaml:"profiles"`
+	RevalidateProfile string                   `yaml:"revalidate_profile"`
 }
 
 func LoadConfigFromFile(path string) (*Config, error) {
@@ -63,8 +260,10 @@ func NewConfig() *Config {
 	}
 
 	finalConfig := &Config{
-		ParallelTests: 15,
-		ProxyTimeoutS: 30,
+		ParallelTests:  15,
+		ProxyTimeoutS:  30,
+		QueueCapacity:  10000,
+		LatencySamples: 3,
 	}
 
 	for _, path := range paths {
@@ -78,5 +277,95 @@ func NewConfig() *Config {
 
 	finalConfig.ParallelTests = max(min(finalConfig.ParallelTests, 1000), 1)
 
+	q := &finalConfig.Quarantine
+	q.MinChecked = cmp.Or(q.MinChecked, 50)
+	q.MinYield = cmp.Or(q.MinYield, 0.01)
+	q.MaxFailures = cmp.Or(q.MaxFailures, 5)
+	q.Multiplier = cmp.Or(q.Multiplier, 2)
+	q.MaxSlowdowns = cmp.Or(q.MaxSlowdowns, 3)
+	q.ProbeInterval = cmp.Or(q.ProbeInterval, 24*time.Hour)
+
+	pf := &finalConfig.Prefilter
+	pf.Workers = cmp.Or(pf.Workers, 200)
+	pf.Timeout = cmp.Or(pf.Timeout, 3*time.Second)
+
+	bw := &finalConfig.Bandwidth
+	bw.DownloadURL = cmp.Or(bw.DownloadURL, "http://httpbin.org/stream-bytes/102400")
+	bw.UploadSize = cmp.Or(bw.UploadSize, 100*1024)
+
+	ws := &finalConfig.WSStability
+	ws.Duration = cmp.Or(ws.Duration, time.Minute)
+	ws.Interval = cmp.Or(ws.Interval, 5*time.Second)
+
+	cp := &finalConfig.ConnectPorts
+	cp.Host = cmp.Or(cp.Host, "portquiz.net")
+	if len(cp.Ports) == 0 {
+		cp.Ports = []int{25, 443, 5222, 8080, 8443}
+	}
+
+	hv := &finalConfig.HTTPVersions
+	hv.HTTP2URL = cmp.Or(hv.HTTP2URL, "https://httpbin.org/get")
+	hv.HTTP3URL = cmp.Or(hv.HTTP3URL, "https://cloudflare-quic.com/")
+
+	dj := &finalConfig.DNSJudge
+	dj.Listen = cmp.Or(dj.Listen, ":53")
+	dj.HTTPPort = cmp.Or(dj.HTTPPort, 8053)
+
+	jc := &finalConfig.Judges
+	if len(jc.Get) == 0 {
+		jc.Get = []string{"http://httpbin.org/get"}
+	}
+	if len(jc.IP) == 0 {
+		jc.IP = []string{"https://httpbin.org/ip"}
+	}
+	if len(jc.WebSocket) == 0 {
+		jc.WebSocket = []string{"ws://echo.websocket.org"}
+	}
+	if len(jc.Fetch) == 0 && finalConfig.FetchItemUrl != "" {
+		jc.Fetch = []string{finalConfig.FetchItemUrl}
+	}
+	jc.Interval = cmp.Or(jc.Interval, 30*time.Second)
+	jc.FetchInterval = cmp.Or(jc.FetchInterval, 30*time.Minute)
+	jc.Timeout = cmp.Or(jc.Timeout, 10*time.Second)
+
+	cc := &finalConfig.Concurrency
+	cc.Min = max(cc.Min, 1)
+	cc.Max = max(cmp.Or(cc.Max, 1000), cc.Min)
+	cc.Interval = cmp.Or(cc.Interval, 5*time.Second)
+	cc.MaxFDRatio = cmp.Or(cc.MaxFDRatio, 0.8)
+	cc.MaxGoroutines = cmp.Or(cc.MaxGoroutines, 50000)
+	cc.MaxTimeoutRatio = cmp.Or(cc.MaxTimeoutRatio, 0.5)
+	cc.TimeoutWindows = cmp.Or(cc.TimeoutWindows, 3)
+	cc.MaxCPU = cmp.Or(cc.MaxCPU, 0.9)
+
 	return finalConfig
 }
+
+// ProviderConfigs returns the structured providers followed by the legacy
+// source lists, with defaults applied.
+func (c *Config) ProviderConfigs() []ProviderConfig {
+	var list []ProviderConfig
+	list = append(list, c.Providers...)
+	for _, source := range c.UrlSourceList {
+		list = append(list, ProviderConfig{Type: ProviderUrl, Source: source})
+	}
+	for _, source := range c.HostPortSourceList {
+		list = append(list, ProviderConfig{Type: ProviderHostPort, Source: source})
+	}
+	for _, source := range c.FileSourceList {
+		list = append(list, ProviderConfig{Type: ProviderFile, Source: source})
+	}
+
+	for i := range list {
+		if list[i].Type == "" {
+			list[i].Type = ProviderHostPort
+		}
+		if list[i].Interval <= 0 {
+			list[i].Interval = time.Hour
+		}
+		if c.UseDBProxy {
+			list[i].FetchViaProxy = true
+		}
+	}
+	return list
+}
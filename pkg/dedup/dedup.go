@@ -11,6 +11,8 @@ import (
 	bolt "go.etcd.io/bbolt"
 )
 
+var goodBucket = []byte("good")
+
 // Deduplicator holds the bbolt DB.
 type Deduplicator struct {
 	db     *bolt.DB
@@ -44,8 +46,12 @@ func New(dbPath string) (*Deduplicator, error) {
 	}
 	d := &Deduplicator{db: db, bucket: []byte("proxies")}
 	if err := db.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists(d.bucket)
-		return err
+		for _, name := range [][]byte{d.bucket, goodBucket, sourcesBucket, sourceEntriesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
 	}); err != nil {
 		db.Close()
 		return nil, err
@@ -84,6 +90,37 @@ func (d *Deduplicator) ShouldProcess(p domain.ProvidedProxy, age time.Duration)
 	return time.Since(lastTime) >= age
 }
 
+// Seen reports whether the proxy was ever marked processed.
+func (d *Deduplicator) Seen(p domain.ProvidedProxy) bool {
+	var seen bool
+	_ = d.db.View(func(tx *bolt.Tx) error {
+		seen = tx.Bucket(d.bucket).Get(p.Key()) != nil
+		return nil
+	})
+	return seen
+}
+
+// Good reports whether the proxy passed its last check.
+func (d *Deduplicator) Good(p domain.ProvidedProxy) bool {
+	var good bool
+	_ = d.db.View(func(tx *bolt.Tx) error {
+		good = tx.Bucket(goodBucket).Get(p.Key()) != nil
+		return nil
+	})
+	return good
+}
+
+// MarkGood records whether the proxy passed its check.
+func (d *Deduplicator) MarkGood(p domain.ProvidedProxy, good bool) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(goodBucket)
+		if !good {
+			return b.Delete(p.Key())
+		}
+		return b.Put(p.Key(), []byte{1})
+	})
+}
+
 // MarkProcessed records the current timestamp for this proxy.
 func (d *Deduplicator) MarkProcessed(p domain.ProvidedProxy) error {
 	now := uint64(time.Now().UnixNano())
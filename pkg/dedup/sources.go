@@ -0,0 +1,85 @@
+package dedup
+
+import (
+	"encoding/json"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	sourcesBucket       = []byte("sources")
+	sourceEntriesBucket = []byte("source_entries")
+)
+
+// SourceState is what is remembered about a provider source between fetches.
+type SourceState struct {
+	ETag         string `json:"etag"`
+	LastModified string `json:"last_modified"`
+	Hash         string `json:"hash"`
+}
+
+// SourceState returns the stored state for source.
+// A missing or corrupted record yields the zero state.
+func (d *Deduplicator) SourceState(source string) SourceState {
+	var st SourceState
+	_ = d.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(sourcesBucket).Get([]byte(source))
+		if v == nil {
+			return nil
+		}
+		if err := json.Unmarshal(v, &st); err != nil {
+			st = SourceState{}
+		}
+		return nil
+	})
+	return st
+}
+
+// SaveSourceState stores the state for source.
+func (d *Deduplicator) SaveSourceState(source string, st SourceState) error {
+	v, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	return d.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(sourcesBucket).Put([]byte(source), v)
+	})
+}
+
+// SourceEntries returns the set of entry keys emitted by the last fetch of source.
+func (d *Deduplicator) SourceEntries(source string) (map[string]struct{}, error) {
+	entries := make(map[string]struct{})
+	err := d.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(sourceEntriesBucket).Bucket([]byte(source))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, _ []byte) error {
+			entries[string(k)] = struct{}{}
+			return nil
+		})
+	})
+	return entries, err
+}
+
+// SaveSourceEntries replaces the stored entry set of source.
+func (d *Deduplicator) SaveSourceEntries(source string, entries map[string]struct{}) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		parent := tx.Bucket(sourceEntriesBucket)
+		if parent.Bucket([]byte(source)) != nil {
+			if err := parent.DeleteBucket([]byte(source)); err != nil {
+				return err
+			}
+		}
+		b, err := parent.CreateBucket([]byte(source))
+		if err != nil {
+			return err
+		}
+		for k := range entries {
+			if err := b.Put([]byte(k), []byte{}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
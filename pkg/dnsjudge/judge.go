@@ -0,0 +1,242 @@
+package dnsjudge
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// nameTTL is how long the resolvers of a generated name are remembered.
+const nameTTL = 10 * time.Minute
+
+// Judge is a DNS stand-in for a delegated zone. It answers every A query
+// under the zone with its own address and remembers which resolvers asked
+// for which name, and serves a tiny HTTP endpoint on that address. A check
+// requests a fresh name through the proxy; the resolvers that looked the
+// name up tell whether the proxy resolved it remotely or the client leaked
+// the lookup to its local resolver.
+type Judge struct {
+	zone     string
+	answer   net.IP
+	dnsAddr  string
+	httpPort int
+	log      *zap.Logger
+
+	mu    sync.Mutex
+	names map[string]*lookups
+	local map[string]bool
+}
+
+type lookups struct {
+	created   time.Time
+	resolvers []string
+}
+
+// New creates a judge for zone. answer is the public IPv4 address of this
+// host that the zone is delegated to, dnsAddr the UDP listen address and
+// httpPort the port of the HTTP endpoint.
+func New(zone string, answer net.IP, dnsAddr string, httpPort int, log *zap.Logger) (*Judge, error) {
+	if answer.To4() == nil {
+		return nil, errors.New("dnsjudge: answer must be an IPv4 address")
+	}
+	return &Judge{
+		zone:     strings.ToLower(strings.Trim(zone, ".")),
+		answer:   answer.To4(),
+		dnsAddr:  dnsAddr,
+		httpPort: httpPort,
+		log:      log,
+		names:    make(map[string]*lookups),
+		local:    make(map[string]bool),
+	}, nil
+}
+
+// NewName returns an unused hostname under the zone.
+func (j *Judge) NewName() string {
+	token := make([]byte, 8)
+	_, _ = rand.Read(token)
+	name := hex.EncodeToString(token) + "." + j.zone
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.names[name] = &lookups{created: time.Now()}
+	return name
+}
+
+// URL returns the HTTP endpoint of the judge under name.
+func (j *Judge) URL(name string) string {
+	return "http://" + net.JoinHostPort(name, strconv.Itoa(j.httpPort)) + "/"
+}
+
+// Resolvers returns the addresses of the resolvers that looked up name.
+func (j *Judge) Resolvers(name string) []string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if l, ok := j.names[name]; ok {
+		return append([]string(nil), l.resolvers...)
+	}
+	return nil
+}
+
+// IsLocal reports whether resolver is one of the resolvers this host uses.
+func (j *Judge) IsLocal(resolver string) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.local[resolver]
+}
+
+// LearnLocal resolves a fresh name through the system resolver so lookups
+// coming from the same resolvers can later be recognised as leaks.
+func (j *Judge) LearnLocal(ctx context.Context) error {
+	name := j.NewName()
+	if _, err := net.DefaultResolver.LookupIPAddr(ctx, name); err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, r := range j.names[name].resolvers {
+		j.local[r] = true
+	}
+	j.log.Info("learned local dns resolvers", zap.Int("resolvers", len(j.local)))
+	return nil
+}
+
+// Start binds the DNS and HTTP listeners and serves them until ctx is done.
+func (j *Judge) Start(ctx context.Context) error {
+	pc, err := net.ListenPacket("udp", j.dnsAddr)
+	if err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", ":"+strconv.Itoa(j.httpPort))
+	if err != nil {
+		_ = pc.Close()
+		return err
+	}
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(r.Host))
+		}),
+	}
+	go func() {
+		<-ctx.Done()
+		_ = pc.Close()
+		_ = srv.Close()
+	}()
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			j.log.Error("dns judge http failed", zap.Error(err))
+		}
+	}()
+	go j.expire(ctx)
+	go j.serveDNS(ctx, pc)
+	return nil
+}
+
+func (j *Judge) serveDNS(ctx context.Context, pc net.PacketConn) {
+	buf := make([]byte, 512)
+	for {
+		n, from, err := pc.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() == nil {
+				j.log.Error("dns judge failed", zap.Error(err))
+			}
+			return
+		}
+		if reply := j.answerQuery(buf[:n], from); reply != nil {
+			_, _ = pc.WriteTo(reply, from)
+		}
+	}
+}
+
+func (j *Judge) answerQuery(packet []byte, from net.Addr) []byte {
+	var p dnsmessage.Parser
+	header, err := p.Start(packet)
+	if err != nil {
+		return nil
+	}
+	q, err := p.Question()
+	if err != nil {
+		return nil
+	}
+
+	name := strings.ToLower(strings.TrimSuffix(q.Name.String(), "."))
+	resp := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:                 header.ID,
+			Response:           true,
+			Authoritative:      true,
+			RecursionDesired:   header.RecursionDesired,
+			RecursionAvailable: false,
+		},
+		Questions: []dnsmessage.Question{q},
+	}
+	if name != j.zone && !strings.HasSuffix(name, "."+j.zone) {
+		resp.Header.RCode = dnsmessage.RCodeRefused
+	} else if q.Type == dnsmessage.TypeA {
+		j.record(name, from)
+		var a [4]byte
+		copy(a[:], j.answer)
+		resp.Answers = []dnsmessage.Resource{{
+			Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 0},
+			Body:   &dnsmessage.AResource{A: a},
+		}}
+	} else {
+		// other types of a known name are empty, which keeps AAAA lookups from failing
+		j.record(name, from)
+	}
+
+	reply, err := resp.Pack()
+	if err != nil {
+		return nil
+	}
+	return reply
+}
+
+func (j *Judge) record(name string, from net.Addr) {
+	host, _, err := net.SplitHostPort(from.String())
+	if err != nil {
+		return
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	l, ok := j.names[name]
+	if !ok {
+		return
+	}
+	for _, r := range l.resolvers {
+		if r == host {
+			return
+		}
+	}
+	l.resolvers = append(l.resolvers, host)
+}
+
+func (j *Judge) expire(ctx context.Context) {
+	ticker := time.NewTicker(nameTTL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			j.mu.Lock()
+			for name, l := range j.names {
+				if time.Since(l.created) > nameTTL {
+					delete(j.names, name)
+				}
+			}
+			j.mu.Unlock()
+		}
+	}
+}
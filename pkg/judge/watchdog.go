@@ -0,0 +1,316 @@
+package judge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+	"go.uber.org/zap"
+)
+
+// Candidates are the judge URLs of every role in failover order. A role
+// without candidates is not watched.
+type Candidates struct {
+	Get       []string
+	IP        []string
+	WebSocket []string
+	Fetch     []string
+}
+
+// Endpoints are the judges currently used for checks.
+type Endpoints struct {
+	GetURL       string
+	IPURL        string
+	WebSocketURL string
+	FetchURL     string
+}
+
+// Status is the result of the last probe of one judge.
+type Status struct {
+	Role    string        `json:"role"`
+	URL     string        `json:"url"`
+	Healthy bool          `json:"healthy"`
+	Latency time.Duration `json:"latency"`
+	Error   string        `json:"error,omitempty"`
+	Checked time.Time     `json:"checked"`
+}
+
+// Limiter throttles requests per destination host.
+type Limiter interface {
+	Wait(ctx context.Context, url string) error
+}
+
+type role struct {
+	name       string
+	candidates []string
+	probe      func(ctx context.Context, url string) error
+	get        func(e Endpoints) string
+	set        func(e *Endpoints, url string)
+	// interval is the least time between probes of the role, zero probes
+	// it every time.
+	interval time.Duration
+}
+
+// Option configures a Watchdog.
+type Option func(*Watchdog)
+
+// WithLimits makes every probe wait for the budget of its judge's host.
+func WithLimits(l Limiter) Option {
+	return func(w *Watchdog) {
+		w.limits = l
+	}
+}
+
+// WithFetchInterval probes the fetch judges at most every d. While one of
+// them was healthy at its last probe the result is kept in between.
+func WithFetchInterval(d time.Duration) Option {
+	return func(w *Watchdog) {
+		w.fetchInterval = d
+	}
+}
+
+// Watchdog probes the judges directly, without a proxy, and hands out the
+// first healthy judge of every role. Probes wait for the host limits like
+// the checks do. While a role has no healthy judge the
+// checks are paused, and every probe that finds a judge in use failing
+// starts a new epoch so checks that ran against it can be thrown away.
+type Watchdog struct {
+	roles         []role
+	timeout       time.Duration
+	fetchInterval time.Duration
+	limits        Limiter
+	log           *zap.Logger
+	client        *http.Client
+
+	mu       sync.Mutex
+	current  Endpoints
+	healthy  bool
+	epoch    uint64
+	statuses []Status
+	changed  chan struct{}
+}
+
+// New creates a watchdog that gives every probe timeout to finish. Checks
+// are paused until the first Probe.
+func New(candidates Candidates, timeout time.Duration, log *zap.Logger, opts ...Option) *Watchdog {
+	w := &Watchdog{
+		timeout: timeout,
+		log:     log,
+		client:  &http.Client{Timeout: timeout},
+		changed: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	w.roles = []role{
+		{"get", candidates.Get, w.probeHTTP,
+			func(e Endpoints) string { return e.GetURL },
+			func(e *Endpoints, url string) { e.GetURL = url }, 0},
+		{"ip", candidates.IP, w.probeHTTP,
+			func(e Endpoints) string { return e.IPURL },
+			func(e *Endpoints, url string) { e.IPURL = url }, 0},
+		{"websocket", candidates.WebSocket, w.probeWebSocket,
+			func(e Endpoints) string { return e.WebSocketURL },
+			func(e *Endpoints, url string) { e.WebSocketURL = url }, 0},
+		{"fetch", candidates.Fetch, w.probeHTTP,
+			func(e Endpoints) string { return e.FetchURL },
+			func(e *Endpoints, url string) { e.FetchURL = url }, w.fetchInterval},
+	}
+	return w
+}
+
+// Probe tests every judge once and switches to the first healthy judge of
+// each role. It has the reconcile signature so it can be scheduled by the
+// reconciler, and fails while any role has no healthy judge.
+func (w *Watchdog) Probe(ctx context.Context) error {
+	var (
+		statuses []Status
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+	)
+	w.mu.Lock()
+	last := w.statuses
+	w.mu.Unlock()
+	for _, r := range w.roles {
+		if kept := r.recent(last); kept != nil {
+			statuses = append(statuses, kept...)
+			continue
+		}
+		for _, url := range r.candidates {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if w.limits != nil {
+					if err := w.limits.Wait(ctx, url); err != nil {
+						return
+					}
+				}
+				start := time.Now()
+				err := r.probe(ctx, url)
+				st := Status{Role: r.name, URL: url, Healthy: err == nil, Latency: time.Since(start), Checked: time.Now()}
+				if err != nil {
+					st.Error = err.Error()
+				}
+				mu.Lock()
+				statuses = append(statuses, st)
+				mu.Unlock()
+			}()
+		}
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	up := make(map[string]bool, len(statuses))
+	for _, st := range statuses {
+		up[st.Role+" "+st.URL] = st.Healthy
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var (
+		next   Endpoints
+		down   []string
+		failed bool
+	)
+	for _, r := range w.roles {
+		if url := r.get(w.current); url != "" && !up[r.name+" "+url] {
+			failed = true
+		}
+
+		chosen := ""
+		for _, url := range r.candidates {
+			if up[r.name+" "+url] {
+				chosen = url
+				break
+			}
+		}
+		if chosen == "" && len(r.candidates) > 0 {
+			down = append(down, r.name)
+		}
+		r.set(&next, chosen)
+	}
+
+	if failed {
+		// checks since the last probe may have failed because of the judge
+		w.epoch++
+	}
+	w.statuses = statuses
+	if healthy := len(down) == 0; healthy != w.healthy || next != w.current {
+		w.current = next
+		w.healthy = healthy
+		w.log.Info("judges changed",
+			zap.Bool("healthy", w.healthy),
+			zap.Strings("down", down),
+			zap.Any("endpoints", next),
+		)
+		close(w.changed)
+		w.changed = make(chan struct{})
+	}
+
+	if len(down) > 0 {
+		return fmt.Errorf("no healthy judge for %s", strings.Join(down, ", "))
+	}
+	return nil
+}
+
+// recent returns the statuses of the role's last probe while they are
+// younger than its interval and one of them was healthy, nil when the role
+// is due.
+func (r role) recent(last []Status) []Status {
+	if r.interval <= 0 {
+		return nil
+	}
+	var (
+		kept    []Status
+		healthy bool
+	)
+	for _, st := range last {
+		if st.Role != r.name {
+			continue
+		}
+		if time.Since(st.Checked) >= r.interval {
+			return nil
+		}
+		kept = append(kept, st)
+		healthy = healthy || st.Healthy
+	}
+	if !healthy || len(kept) != len(r.candidates) {
+		return nil
+	}
+	return kept
+}
+
+// Wait blocks while a role has no healthy judge and returns the judges to
+// check with and the current epoch. ok is false when ctx is done first.
+func (w *Watchdog) Wait(ctx context.Context) (e Endpoints, epoch uint64, ok bool) {
+	for {
+		w.mu.Lock()
+		if w.healthy {
+			e, epoch = w.current, w.epoch
+			w.mu.Unlock()
+			return e, epoch, true
+		}
+		changed := w.changed
+		w.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return Endpoints{}, 0, false
+		case <-changed:
+		}
+	}
+}
+
+// Valid reports whether no judge in use has failed since epoch.
+func (w *Watchdog) Valid(epoch uint64) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.epoch == epoch
+}
+
+// Statuses returns the result of the last probe of every judge.
+func (w *Watchdog) Statuses() []Status {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]Status(nil), w.statuses...)
+}
+
+// probeHTTP requires a response that is not a server error. The fetch
+// judge may well answer a direct request with a client error.
+func (w *Watchdog) probeHTTP(ctx context.Context, url string) error {
+	ctx, cancel := context.WithTimeout(ctx, w.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return errors.New(resp.Status)
+	}
+	return nil
+}
+
+func (w *Watchdog) probeWebSocket(ctx context.Context, url string) error {
+	ctx, cancel := context.WithTimeout(ctx, w.timeout)
+	defer cancel()
+
+	conn, _, err := websocket.Dial(ctx, url, nil)
+	if err != nil {
+		return err
+	}
+	return conn.Close(websocket.StatusNormalClosure, "")
+}
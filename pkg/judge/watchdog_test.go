@@ -0,0 +1,158 @@
+package judge
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// server is a judge that answers 500 while down and counts its requests.
+type server struct {
+	*httptest.Server
+	down atomic.Bool
+	hits atomic.Int32
+}
+
+func newServer(t *testing.T) *server {
+	t.Helper()
+	s := &server{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.hits.Add(1)
+		if s.down.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestWatchdogFailover(t *testing.T) {
+	a, b := newServer(t), newServer(t)
+	w := New(Candidates{Get: []string{a.URL, b.URL}}, time.Second, zap.NewNop())
+	ctx := context.Background()
+
+	tests := []struct {
+		name         string
+		aDown, bDown bool
+		url          string
+		healthy      bool
+		epoch        uint64
+	}{
+		{"both up", false, false, a.URL, true, 0},
+		// checks that ran against a may have failed because of it
+		{"first down", true, false, b.URL, true, 1},
+		{"still down", true, false, b.URL, true, 1},
+		// the judge in use did not fail, so nothing is thrown away
+		{"first recovered", false, false, a.URL, true, 1},
+		{"all down", true, true, "", false, 2},
+		{"second recovered", true, false, b.URL, true, 2},
+	}
+	for _, tt := range tests {
+		a.down.Store(tt.aDown)
+		b.down.Store(tt.bDown)
+		err := w.Probe(ctx)
+		if (err == nil) != tt.healthy {
+			t.Errorf("%s: Probe = %v, want healthy %v", tt.name, err, tt.healthy)
+		}
+		w.mu.Lock()
+		current, healthy, epoch := w.current, w.healthy, w.epoch
+		w.mu.Unlock()
+		if current.GetURL != tt.url || healthy != tt.healthy || epoch != tt.epoch {
+			t.Errorf("%s: judge %q healthy %v epoch %d, want %q, %v, %d",
+				tt.name, current.GetURL, healthy, epoch, tt.url, tt.healthy, tt.epoch)
+		}
+		if !w.Valid(tt.epoch) {
+			t.Errorf("%s: epoch %d not valid", tt.name, tt.epoch)
+		}
+	}
+	if w.Valid(0) {
+		t.Error("epoch 0 still valid after the judge in use failed")
+	}
+}
+
+func TestWatchdogWaitPausesChecks(t *testing.T) {
+	a := newServer(t)
+	w := New(Candidates{Get: []string{a.URL}}, time.Second, zap.NewNop())
+	a.down.Store(true)
+	_ = w.Probe(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, _, ok := w.Wait(ctx); ok {
+		t.Fatal("Wait returned without a healthy judge")
+	}
+
+	done := make(chan Endpoints, 1)
+	go func() {
+		e, _, _ := w.Wait(context.Background())
+		done <- e
+	}()
+	a.down.Store(false)
+	if err := w.Probe(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-done:
+		if e.GetURL != a.URL {
+			t.Errorf("Wait = %+v, want the recovered judge", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Wait still blocked after the judge recovered")
+	}
+}
+
+// recorder is a Limiter that records the URLs it was asked about.
+type recorder struct {
+	mu   sync.Mutex
+	urls []string
+}
+
+func (r *recorder) Wait(_ context.Context, url string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.urls = append(r.urls, url)
+	return nil
+}
+
+func TestWatchdogFetchInterval(t *testing.T) {
+	get, fetch := newServer(t), newServer(t)
+	limits := &recorder{}
+	w := New(Candidates{Get: []string{get.URL}, Fetch: []string{fetch.URL}}, time.Second, zap.NewNop(),
+		WithLimits(limits), WithFetchInterval(time.Hour))
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if err := w.Probe(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := get.hits.Load(); n != 3 {
+		t.Errorf("get judge probed %d times, want every time", n)
+	}
+	if n := fetch.hits.Load(); n != 1 {
+		t.Errorf("fetch judge probed %d times, want once within the interval", n)
+	}
+	if n := len(limits.urls); n != 4 {
+		t.Errorf("%d probes waited for the limits, want all 4", n)
+	}
+	if len(w.Statuses()) != 2 {
+		t.Errorf("statuses %+v, want the kept fetch status too", w.Statuses())
+	}
+
+	// an unhealthy fetch judge is probed again right away
+	w.mu.Lock()
+	for i := range w.statuses {
+		w.statuses[i].Healthy = false
+	}
+	w.mu.Unlock()
+	_ = w.Probe(ctx)
+	if n := fetch.hits.Load(); n != 2 {
+		t.Errorf("fetch judge probed %d times, want a reprobe after a failure", n)
+	}
+}
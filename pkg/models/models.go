@@ -8,6 +8,30 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type ProviderStat struct {
+	Provider        string
+	LastFetchAt     pgtype.Timestamp
+	FetchDurationMs pgtype.Int4
+	HttpStatus      pgtype.Int4
+	FetchError      pgtype.Text
+	EntriesParsed   pgtype.Int4
+	ParseFailures   pgtype.Int4
+	UniqueNew       int64
+	Checked         int64
+	Passed          int64
+	EntriesRejected pgtype.Int4
+}
+
+type ProxyCheckError struct {
+	Ip         string
+	Port       int32
+	Protocol   string
+	Provider   pgtype.Text
+	ErrorClass string
+	Error      pgtype.Text
+	TestedAt   pgtype.Timestamp
+}
+
 type ProxyInfo struct {
 	Ip                  string
 	Port                int32
@@ -20,4 +44,56 @@ type ProxyInfo struct {
 	ItemFetch           pgtype.Bool
 	FetchErrorCount     pgtype.Int4
 	WebsocketErrorCount pgtype.Int4
+	ConnectMs           pgtype.Int4
+	HandshakeMs         pgtype.Int4
+	TtfbMs              pgtype.Int4
+	P50Ms               pgtype.Int4
+	P90Ms               pgtype.Int4
+	JitterMs            pgtype.Int4
+	DownloadKbytesS     pgtype.Int4
+	UploadKbytesS       pgtype.Int4
+	WsRttMs             pgtype.Int4
+	WsStability         pgtype.Float4
+	WsUptimeS           pgtype.Int4
+	ConnectPorts        []int32
+	Http2               pgtype.Bool
+	Http3               pgtype.Bool
+	RemoteDns           pgtype.Bool
+	DnsLeak             pgtype.Bool
+	Flagged             bool
+	FlagReason          pgtype.Text
+	Profile             pgtype.Text
+}
+
+type TrustedProxyInfo struct {
+	Ip                  string
+	Port                int32
+	Protocol            string
+	Provider            pgtype.Text
+	DelayMs             pgtype.Int4
+	TestedAt            pgtype.Timestamp
+	Websocket           pgtype.Bool
+	Anonymity           pgtype.Bool
+	ItemFetch           pgtype.Bool
+	FetchErrorCount     pgtype.Int4
+	WebsocketErrorCount pgtype.Int4
+	ConnectMs           pgtype.Int4
+	HandshakeMs         pgtype.Int4
+	TtfbMs              pgtype.Int4
+	P50Ms               pgtype.Int4
+	P90Ms               pgtype.Int4
+	JitterMs            pgtype.Int4
+	DownloadKbytesS     pgtype.Int4
+	UploadKbytesS       pgtype.Int4
+	WsRttMs             pgtype.Int4
+	WsStability         pgtype.Float4
+	WsUptimeS           pgtype.Int4
+	ConnectPorts        []int32
+	Http2               pgtype.Bool
+	Http3               pgtype.Bool
+	RemoteDns           pgtype.Bool
+	DnsLeak             pgtype.Bool
+	Flagged             bool
+	FlagReason          pgtype.Text
+	Profile             pgtype.Text
 }
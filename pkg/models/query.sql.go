@@ -11,29 +11,114 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const addProviderChecks = `-- name: AddProviderChecks :exec
+insert into provider_stats (provider, unique_new, checked, passed)
+values ($1, $2, $3, $4)
+on conflict (provider) do update
+    set unique_new = provider_stats.unique_new + EXCLUDED.unique_new,
+        checked    = provider_stats.checked + EXCLUDED.checked,
+        passed     = provider_stats.passed + EXCLUDED.passed
+`
+
+type AddProviderChecksParams struct {
+	Provider  string
+	UniqueNew int64
+	Checked   int64
+	Passed    int64
+}
+
+func (q *Queries) AddProviderChecks(ctx context.Context, arg AddProviderChecksParams) error {
+	_, err := q.db.Exec(ctx, addProviderChecks,
+		arg.Provider,
+		arg.UniqueNew,
+		arg.Checked,
+		arg.Passed,
+	)
+	return err
+}
+
+const deleteProxyCheckError = `-- name: DeleteProxyCheckError :exec
+delete
+from proxy_check_error
+where ip = $1
+  and port = $2
+  and protocol = $3
+`
+
+type DeleteProxyCheckErrorParams struct {
+	Ip       string
+	Port     int32
+	Protocol string
+}
+
+func (q *Queries) DeleteProxyCheckError(ctx context.Context, arg DeleteProxyCheckErrorParams) error {
+	_, err := q.db.Exec(ctx, deleteProxyCheckError, arg.Ip, arg.Port, arg.Protocol)
+	return err
+}
+
 const insertProxyInfoTestResults = `-- name: InsertProxyInfoTestResults :exec
-insert into proxy_info (ip, port, protocol, provider, delay_ms, tested_at, websocket, anonymity, item_fetch)
-values ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+insert into proxy_info (ip, port, protocol, provider, delay_ms, tested_at, websocket, anonymity, item_fetch,
+                        connect_ms, handshake_ms, ttfb_ms, p50_ms, p90_ms, jitter_ms, download_kbytes_s,
+                        upload_kbytes_s, ws_rtt_ms, ws_stability, ws_uptime_s, connect_ports, http2, http3,
+                        remote_dns, dns_leak, profile)
+values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22,
+        $23, $24, $25, $26)
 on conflict (ip, port, protocol) do update
-    set delay_ms   = EXCLUDED.delay_ms,
-        tested_at  = EXCLUDED.tested_at,
-        websocket  = EXCLUDED.websocket,
-        anonymity  = EXCLUDED.anonymity,
-        item_fetch = EXCLUDED.item_fetch
+    set delay_ms          = EXCLUDED.delay_ms,
+        tested_at         = EXCLUDED.tested_at,
+        websocket         = coalesce(EXCLUDED.websocket, proxy_info.websocket),
+        anonymity         = EXCLUDED.anonymity,
+        item_fetch        = coalesce(EXCLUDED.item_fetch, proxy_info.item_fetch),
+        connect_ms        = coalesce(EXCLUDED.connect_ms, proxy_info.connect_ms),
+        handshake_ms      = coalesce(EXCLUDED.handshake_ms, proxy_info.handshake_ms),
+        ttfb_ms           = coalesce(EXCLUDED.ttfb_ms, proxy_info.ttfb_ms),
+        p50_ms            = coalesce(EXCLUDED.p50_ms, proxy_info.p50_ms),
+        p90_ms            = coalesce(EXCLUDED.p90_ms, proxy_info.p90_ms),
+        jitter_ms         = coalesce(EXCLUDED.jitter_ms, proxy_info.jitter_ms),
+        download_kbytes_s = coalesce(EXCLUDED.download_kbytes_s, proxy_info.download_kbytes_s),
+        upload_kbytes_s   = coalesce(EXCLUDED.upload_kbytes_s, proxy_info.upload_kbytes_s),
+        ws_rtt_ms         = coalesce(EXCLUDED.ws_rtt_ms, proxy_info.ws_rtt_ms),
+        ws_stability      = coalesce(EXCLUDED.ws_stability, proxy_info.ws_stability),
+        ws_uptime_s       = coalesce(EXCLUDED.ws_uptime_s, proxy_info.ws_uptime_s),
+        connect_ports     = coalesce(EXCLUDED.connect_ports, proxy_info.connect_ports),
+        http2             = coalesce(EXCLUDED.http2, proxy_info.http2),
+        http3             = coalesce(EXCLUDED.http3, proxy_info.http3),
+        remote_dns        = coalesce(EXCLUDED.remote_dns, proxy_info.remote_dns),
+        dns_leak          = coalesce(EXCLUDED.dns_leak, proxy_info.dns_leak),
+        profile           = EXCLUDED.profile
 `
 
 type InsertProxyInfoTestResultsParams struct {
-	Ip        string
-	Port      int32
-	Protocol  string
-	Provider  pgtype.Text
-	DelayMs   pgtype.Int4
-	TestedAt  pgtype.Timestamp
-	Websocket pgtype.Bool
-	Anonymity pgtype.Bool
-	ItemFetch pgtype.Bool
+	Ip              string
+	Port            int32
+	Protocol        string
+	Provider        pgtype.Text
+	DelayMs         pgtype.Int4
+	TestedAt        pgtype.Timestamp
+	Websocket       pgtype.Bool
+	Anonymity       pgtype.Bool
+	ItemFetch       pgtype.Bool
+	ConnectMs       pgtype.Int4
+	HandshakeMs     pgtype.Int4
+	TtfbMs          pgtype.Int4
+	P50Ms           pgtype.Int4
+	P90Ms           pgtype.Int4
+	JitterMs        pgtype.Int4
+	DownloadKbytesS pgtype.Int4
+	UploadKbytesS   pgtype.Int4
+	WsRttMs         pgtype.Int4
+	WsStability     pgtype.Float4
+	WsUptimeS       pgtype.Int4
+	ConnectPorts    []int32
+	Http2           pgtype.Bool
+	Http3           pgtype.Bool
+	RemoteDns       pgtype.Bool
+	DnsLeak         pgtype.Bool
+	Profile         pgtype.Text
 }
 
+// columns of the tests a profile skipped are NULL and keep their last value,
+// flagged and flag_reason are only written by SetProxyInfoFlag
 func (q *Queries) InsertProxyInfoTestResults(ctx context.Context, arg InsertProxyInfoTestResultsParams) error {
 	_, err := q.db.Exec(ctx, insertProxyInfoTestResults,
 		arg.Ip,
@@ -45,10 +130,104 @@ func (q *Queries) InsertProxyInfoTestResults(ctx context.Context, arg InsertProx
 		arg.Websocket,
 		arg.Anonymity,
 		arg.ItemFetch,
+		arg.ConnectMs,
+		arg.HandshakeMs,
+		arg.TtfbMs,
+		arg.P50Ms,
+		arg.P90Ms,
+		arg.JitterMs,
+		arg.DownloadKbytesS,
+		arg.UploadKbytesS,
+		arg.WsRttMs,
+		arg.WsStability,
+		arg.WsUptimeS,
+		arg.ConnectPorts,
+		arg.Http2,
+		arg.Http3,
+		arg.RemoteDns,
+		arg.DnsLeak,
+		arg.Profile,
 	)
 	return err
 }
 
+const listHealthyProxies = `-- name: ListHealthyProxies :many
+select ip, port, protocol
+from trusted_proxy_info
+where tested_at > $1
+order by delay_ms
+limit $2
+`
+
+type ListHealthyProxiesParams struct {
+	TestedAt pgtype.Timestamp
+	Limit    int32
+}
+
+type ListHealthyProxiesRow struct {
+	Ip       string
+	Port     int32
+	Protocol string
+}
+
+func (q *Queries) ListHealthyProxies(ctx context.Context, arg ListHealthyProxiesParams) ([]ListHealthyProxiesRow, error) {
+	rows, err := q.db.Query(ctx, listHealthyProxies, arg.TestedAt, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListHealthyProxiesRow
+	for rows.Next() {
+		var i ListHealthyProxiesRow
+		if err := rows.Scan(&i.Ip, &i.Port, &i.Protocol); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listProviderStats = `-- name: ListProviderStats :many
+select provider, last_fetch_at, fetch_duration_ms, http_status, fetch_error, entries_parsed, parse_failures, unique_new, checked, passed, entries_rejected
+from provider_stats
+order by provider
+`
+
+func (q *Queries) ListProviderStats(ctx context.Context) ([]ProviderStat, error) {
+	rows, err := q.db.Query(ctx, listProviderStats)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ProviderStat
+	for rows.Next() {
+		var i ProviderStat
+		if err := rows.Scan(
+			&i.Provider,
+			&i.LastFetchAt,
+			&i.FetchDurationMs,
+			&i.HttpStatus,
+			&i.FetchError,
+			&i.EntriesParsed,
+			&i.ParseFailures,
+			&i.UniqueNew,
+			&i.Checked,
+			&i.Passed,
+			&i.EntriesRejected,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const proxyInfoFetchError = `-- name: ProxyInfoFetchError :exec
 update proxy_info
 set fetch_error_count = fetch_error_count + 1
@@ -86,3 +265,103 @@ func (q *Queries) ProxyInfoWebsocketDisconnect(ctx context.Context, arg ProxyInf
 	_, err := q.db.Exec(ctx, proxyInfoWebsocketDisconnect, arg.Ip, arg.Port, arg.Protocol)
 	return err
 }
+
+const setProxyInfoFlag = `-- name: SetProxyInfoFlag :exec
+update proxy_info
+set flagged     = $4,
+    flag_reason = $5
+where ip = $1
+  and port = $2
+  and protocol = $3
+`
+
+type SetProxyInfoFlagParams struct {
+	Ip         string
+	Port       int32
+	Protocol   string
+	Flagged    bool
+	FlagReason pgtype.Text
+}
+
+func (q *Queries) SetProxyInfoFlag(ctx context.Context, arg SetProxyInfoFlagParams) error {
+	_, err := q.db.Exec(ctx, setProxyInfoFlag,
+		arg.Ip,
+		arg.Port,
+		arg.Protocol,
+		arg.Flagged,
+		arg.FlagReason,
+	)
+	return err
+}
+
+const upsertProviderFetch = `-- name: UpsertProviderFetch :exec
+insert into provider_stats (provider, last_fetch_at, fetch_duration_ms, http_status, fetch_error, entries_parsed, parse_failures,
+                            entries_rejected)
+values ($1, $2, $3, $4, $5, $6, $7, $8)
+on conflict (provider) do update
+    set last_fetch_at     = EXCLUDED.last_fetch_at,
+        fetch_duration_ms = EXCLUDED.fetch_duration_ms,
+        http_status       = EXCLUDED.http_status,
+        fetch_error       = EXCLUDED.fetch_error,
+        entries_parsed    = coalesce(EXCLUDED.entries_parsed, provider_stats.entries_parsed),
+        parse_failures    = coalesce(EXCLUDED.parse_failures, provider_stats.parse_failures),
+        entries_rejected  = coalesce(EXCLUDED.entries_rejected, provider_stats.entries_rejected)
+`
+
+type UpsertProviderFetchParams struct {
+	Provider        string
+	LastFetchAt     pgtype.Timestamp
+	FetchDurationMs pgtype.Int4
+	HttpStatus      pgtype.Int4
+	FetchError      pgtype.Text
+	EntriesParsed   pgtype.Int4
+	ParseFailures   pgtype.Int4
+	EntriesRejected pgtype.Int4
+}
+
+func (q *Queries) UpsertProviderFetch(ctx context.Context, arg UpsertProviderFetchParams) error {
+	_, err := q.db.Exec(ctx, upsertProviderFetch,
+		arg.Provider,
+		arg.LastFetchAt,
+		arg.FetchDurationMs,
+		arg.HttpStatus,
+		arg.FetchError,
+		arg.EntriesParsed,
+		arg.ParseFailures,
+		arg.EntriesRejected,
+	)
+	return err
+}
+
+const upsertProxyCheckError = `-- name: UpsertProxyCheckError :exec
+insert into proxy_check_error (ip, port, protocol, provider, error_class, error, tested_at)
+values ($1, $2, $3, $4, $5, $6, $7)
+on conflict (ip, port, protocol) do update
+    set provider    = EXCLUDED.provider,
+        error_class = EXCLUDED.error_class,
+        error       = EXCLUDED.error,
+        tested_at   = EXCLUDED.tested_at
+`
+
+type UpsertProxyCheckErrorParams struct {
+	Ip         string
+	Port       int32
+	Protocol   string
+	Provider   pgtype.Text
+	ErrorClass string
+	Error      pgtype.Text
+	TestedAt   pgtype.Timestamp
+}
+
+func (q *Queries) UpsertProxyCheckError(ctx context.Context, arg UpsertProxyCheckErrorParams) error {
+	_, err := q.db.Exec(ctx, upsertProxyCheckError,
+		arg.Ip,
+		arg.Port,
+		arg.Protocol,
+		arg.Provider,
+		arg.ErrorClass,
+		arg.Error,
+		arg.TestedAt,
+	)
+	return err
+}
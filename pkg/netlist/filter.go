@@ -0,0 +1,58 @@
+package netlist
+
+// reserved are the ranges a proxy list has no business pointing at: this
+// network, private, carrier-grade NAT, loopback, link-local (including
+// cloud metadata at 169.254.169.254), documentation, benchmarking,
+// multicast and the reserved and broadcast space.
+var reserved = []string{
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.0.2.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"198.51.100.0/24",
+	"203.0.113.0/24",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+}
+
+// Filter decides which proxy addresses may be probed. Deny always wins,
+// Allow exempts addresses from the reserved ranges. A nil Filter allows
+// everything.
+type Filter struct {
+	allow    *List
+	deny     *List
+	reserved *List
+}
+
+// NewFilter builds a filter that rejects the reserved ranges unless
+// allowReserved is set. allow and deny may be nil.
+func NewFilter(allow, deny *List, allowReserved bool) *Filter {
+	f := &Filter{allow: allow, deny: deny}
+	if !allowReserved {
+		f.reserved, _ = New(reserved, nil)
+	}
+	return f
+}
+
+// Allowed reports whether ip may be probed, and the entry that rejected it otherwise.
+func (f *Filter) Allowed(ip string) (string, bool) {
+	if f == nil {
+		return "", true
+	}
+	if entry, ok := f.deny.Match(ip); ok {
+		return entry, false
+	}
+	if _, ok := f.allow.Match(ip); ok {
+		return "", true
+	}
+	if entry, ok := f.reserved.Match(ip); ok {
+		return entry, false
+	}
+	return "", true
+}
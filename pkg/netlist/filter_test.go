@@ -0,0 +1,107 @@
+package netlist
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListMatch(t *testing.T) {
+	l, err := New([]string{"10.0.0.0/8", "192.0.2.7", "2001:db8::/32"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		ip    string
+		entry string
+		ok    bool
+	}{
+		{"10.1.2.3", "10.0.0.0/8", true},
+		{"::ffff:10.1.2.3", "10.0.0.0/8", true},
+		{"192.0.2.7", "192.0.2.7/32", true},
+		{"192.0.2.8", "", false},
+		{"2001:db8::1", "2001:db8::/32", true},
+		{"not an ip", "", false},
+	}
+	for _, tt := range tests {
+		if entry, ok := l.Match(tt.ip); entry != tt.entry || ok != tt.ok {
+			t.Errorf("Match(%q) = %q, %v, want %q, %v", tt.ip, entry, ok, tt.entry, tt.ok)
+		}
+	}
+
+	var nilList *List
+	if _, ok := nilList.Match("10.1.2.3"); ok {
+		t.Error("nil list matched")
+	}
+}
+
+func TestListASEntries(t *testing.T) {
+	if _, err := New([]string{"AS14061"}, nil); err == nil {
+		t.Error("AS entry without an ASN database accepted")
+	}
+
+	path := filepath.Join(t.TempDir(), "asn.tsv")
+	data := "1.0.0.0\t1.0.0.255\t13335\tUS\n5.0.0.0\t5.0.255.255\t0\tNone\n8.8.8.0\t8.8.8.255\t15169\tUS\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	db, err := LoadASNDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if asn, ok := db.Lookup(netip.MustParseAddr("8.8.8.8")); !ok || asn != 15169 {
+		t.Errorf("Lookup(8.8.8.8) = %d, %v, want 15169", asn, ok)
+	}
+	if _, ok := db.Lookup(netip.MustParseAddr("5.0.0.1")); ok {
+		t.Error("unrouted range matched")
+	}
+
+	l, err := New([]string{"as15169"}, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry, ok := l.Match("8.8.8.8"); !ok || entry != "AS15169" {
+		t.Errorf("Match(8.8.8.8) = %q, %v, want AS15169", entry, ok)
+	}
+	if _, ok := l.Match("1.0.0.1"); ok {
+		t.Error("Match(1.0.0.1) matched another AS")
+	}
+}
+
+func TestFilterAllowed(t *testing.T) {
+	allow, _ := New([]string{"192.168.1.0/24"}, nil)
+	deny, _ := New([]string{"203.0.113.0/24", "8.8.8.8"}, nil)
+	f := NewFilter(allow, deny, false)
+
+	tests := []struct {
+		ip    string
+		entry string
+		ok    bool
+	}{
+		{"1.1.1.1", "", true},
+		{"8.8.8.8", "8.8.8.8/32", false},
+		{"127.0.0.1", "127.0.0.0/8", false},
+		{"169.254.169.254", "169.254.0.0/16", false},
+		{"192.168.1.5", "", true},
+		{"192.168.2.5", "192.168.0.0/16", false},
+		// deny wins over the reserved ranges
+		{"203.0.113.9", "203.0.113.0/24", false},
+	}
+	for _, tt := range tests {
+		if entry, ok := f.Allowed(tt.ip); entry != tt.entry || ok != tt.ok {
+			t.Errorf("Allowed(%q) = %q, %v, want %q, %v", tt.ip, entry, ok, tt.entry, tt.ok)
+		}
+	}
+
+	if _, ok := NewFilter(nil, deny, true).Allowed("10.0.0.1"); !ok {
+		t.Error("reserved address rejected with allowReserved")
+	}
+	if _, ok := NewFilter(allow, deny, true).Allowed("8.8.8.8"); ok {
+		t.Error("deny lost against allowReserved")
+	}
+	var nilFilter *Filter
+	if _, ok := nilFilter.Allowed("127.0.0.1"); !ok {
+		t.Error("nil filter rejected an address")
+	}
+}
@@ -0,0 +1,186 @@
+package netlist
+
+import (
+	"bufio"
+	"fmt"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// List matches addresses against CIDR ranges, single addresses and
+// autonomous systems. List files hold one entry per line, such as
+// 10.0.0.0/8, 192.0.2.7 or AS14061; # starts a comment. AS entries only
+// match when the list has an ASN database.
+type List struct {
+	prefixes []netip.Prefix
+	asns     map[uint32]bool
+	db       *ASNDB
+}
+
+// Load reads the list files. db may be nil when no file has AS entries.
+func Load(paths []string, db *ASNDB) (*List, error) {
+	l := &List{asns: make(map[uint32]bool), db: db}
+	for _, path := range paths {
+		if err := l.load(path); err != nil {
+			return nil, err
+		}
+	}
+	return l, l.check()
+}
+
+// New builds a list from entries in list file syntax.
+func New(entries []string, db *ASNDB) (*List, error) {
+	l := &List{asns: make(map[uint32]bool), db: db}
+	for _, entry := range entries {
+		if err := l.Add(entry); err != nil {
+			return nil, err
+		}
+	}
+	return l, l.check()
+}
+
+func (l *List) check() error {
+	if len(l.asns) > 0 && l.db == nil {
+		return fmt.Errorf("netlist: AS entries need an ASN database")
+	}
+	return nil
+}
+
+func (l *List) load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		entry, _, _ := strings.Cut(scanner.Text(), "#")
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if err := l.Add(entry); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// Add adds one entry in list file syntax.
+func (l *List) Add(entry string) error {
+	if rest, ok := strings.CutPrefix(strings.ToUpper(entry), "AS"); ok {
+		asn, err := strconv.ParseUint(rest, 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid AS entry %q", entry)
+		}
+		l.asns[uint32(asn)] = true
+		return nil
+	}
+	if strings.Contains(entry, "/") {
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return err
+		}
+		l.prefixes = append(l.prefixes, prefix.Masked())
+		return nil
+	}
+	addr, err := netip.ParseAddr(entry)
+	if err != nil {
+		return err
+	}
+	l.prefixes = append(l.prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	return nil
+}
+
+// Len is the number of entries.
+func (l *List) Len() int {
+	if l == nil {
+		return 0
+	}
+	return len(l.prefixes) + len(l.asns)
+}
+
+// Match returns the entry ip falls in. A nil List matches nothing.
+func (l *List) Match(ip string) (string, bool) {
+	if l == nil {
+		return "", false
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return "", false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range l.prefixes {
+		if prefix.Contains(addr) {
+			return prefix.String(), true
+		}
+	}
+	if len(l.asns) > 0 {
+		if asn, ok := l.db.Lookup(addr); ok && l.asns[asn] {
+			return "AS" + strconv.FormatUint(uint64(asn), 10), true
+		}
+	}
+	return "", false
+}
+
+// ASNDB maps addresses to autonomous systems.
+type ASNDB struct {
+	ranges []asnRange
+}
+
+type asnRange struct {
+	start, end netip.Addr
+	asn        uint32
+}
+
+// LoadASNDB reads a tab separated range_start, range_end, AS_number file
+// as published by iptoasn.com. Further columns are ignored.
+func LoadASNDB(path string) (*ASNDB, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	db := &ASNDB{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 3 {
+			continue
+		}
+		start, err1 := netip.ParseAddr(fields[0])
+		end, err2 := netip.ParseAddr(fields[1])
+		asn, err3 := strconv.ParseUint(fields[2], 10, 32)
+		if err1 != nil || err2 != nil || err3 != nil {
+			return nil, fmt.Errorf("%s:%d: invalid range", path, line)
+		}
+		if asn == 0 {
+			// not routed
+			continue
+		}
+		db.ranges = append(db.ranges, asnRange{start: start.Unmap(), end: end.Unmap(), asn: uint32(asn)})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(db.ranges, func(i, j int) bool { return db.ranges[i].start.Less(db.ranges[j].start) })
+	return db, nil
+}
+
+// Lookup returns the AS announcing addr.
+func (db *ASNDB) Lookup(addr netip.Addr) (uint32, bool) {
+	if db == nil {
+		return 0, false
+	}
+	// the last range starting at or before addr
+	i := sort.Search(len(db.ranges), func(i int) bool { return addr.Less(db.ranges[i].start) }) - 1
+	if i < 0 || db.ranges[i].end.Less(addr) {
+		return 0, false
+	}
+	return db.ranges[i].asn, true
+}
@@ -0,0 +1,217 @@
+package providers
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"cmp"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// maxArchiveDepth bounds nesting such as .tar.gz inside .zip.
+const maxArchiveDepth = 3
+
+// DefaultMaxListSize caps every list and archive read into memory when the
+// provider has no limit of its own.
+const DefaultMaxListSize = 64 << 20
+
+// ErrBinaryContent is returned for list files that still look binary after
+// all known compression and archive layers were removed.
+var ErrBinaryContent = errors.New("binary content")
+
+// ErrListTooLarge is returned for a download or zip archive over the list
+// size limit.
+var ErrListTooLarge = errors.New("list too large")
+
+type format int
+
+const (
+	formatPlain format = iota
+	formatGzip
+	formatBzip2
+	formatZstd
+	formatZip
+	formatTar
+)
+
+// openLists unwraps compressed and archived content and calls fn for every
+// plain text list it contains. The format is detected by magic bytes first,
+// then by the file extension of name, then by contentType. Every list is
+// cut off at the provider's size limit, and binary archive members are
+// skipped.
+func (o *options) openLists(r io.Reader, name, contentType string, fn func(name string, r io.Reader) error) error {
+	l := lister{fn: fn, limit: o.listLimit()}
+	return l.open(r, name, contentType, 0, false)
+}
+
+// listLimit is the size limit of a downloaded source and of every list in it.
+func (o *options) listLimit() int64 {
+	return cmp.Or(o.maxListSize, DefaultMaxListSize)
+}
+
+type lister struct {
+	fn    func(name string, r io.Reader) error
+	limit int64
+}
+
+func (l *lister) open(r io.Reader, name, contentType string, depth int, member bool) error {
+	br := bufio.NewReaderSize(r, 1024)
+	head, _ := br.Peek(512)
+
+	f := detectFormat(head, name, contentType)
+	if f != formatPlain && depth >= maxArchiveDepth {
+		return fmt.Errorf("%s: archive nested too deep", name)
+	}
+
+	switch f {
+	case formatGzip:
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		defer zr.Close()
+		return l.open(zr, trimExt(name), "", depth+1, member)
+	case formatBzip2:
+		return l.open(bzip2.NewReader(br), trimExt(name), "", depth+1, member)
+	case formatZstd:
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		defer zr.Close()
+		return l.open(zr, trimExt(name), "", depth+1, member)
+	case formatZip:
+		// zip needs random access, so the archive itself is read into memory
+		data, err := io.ReadAll(io.LimitReader(br, l.limit+1))
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if int64(len(data)) > l.limit {
+			return fmt.Errorf("%s: %w", name, ErrListTooLarge)
+		}
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		for _, file := range zr.File {
+			if file.FileInfo().IsDir() {
+				continue
+			}
+			if err := l.openZipFile(file, depth); err != nil {
+				return err
+			}
+		}
+		return nil
+	case formatTar:
+		tr := tar.NewReader(br)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			if hdr.Typeflag != tar.TypeReg {
+				continue
+			}
+			if err := l.open(tr, hdr.Name, "", depth+1, true); err != nil {
+				return err
+			}
+		}
+	}
+
+	if looksBinary(head) {
+		if member {
+			// an archive may well ship a readme image next to the lists
+			return nil
+		}
+		return fmt.Errorf("%s: %w", name, ErrBinaryContent)
+	}
+	return l.fn(name, io.LimitReader(br, l.limit))
+}
+
+func (l *lister) openZipFile(file *zip.File, depth int) error {
+	rc, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("%s: %w", file.Name, err)
+	}
+	defer rc.Close()
+	return l.open(rc, file.Name, "", depth+1, true)
+}
+
+func detectFormat(head []byte, name, contentType string) format {
+	switch {
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return formatGzip
+	case bytes.HasPrefix(head, []byte("BZh")):
+		return formatBzip2
+	case bytes.HasPrefix(head, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return formatZstd
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+		return formatZip
+	case len(head) >= 262 && string(head[257:262]) == "ustar":
+		return formatTar
+	}
+
+	// name and content type are only hints, text content is always plain
+	if !looksBinary(head) {
+		return formatPlain
+	}
+
+	switch strings.ToLower(path.Ext(name)) {
+	case ".gz", ".tgz":
+		return formatGzip
+	case ".bz2", ".tbz2":
+		return formatBzip2
+	case ".zst":
+		return formatZstd
+	case ".zip":
+		return formatZip
+	case ".tar":
+		return formatTar
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/gzip", "application/x-gzip":
+		return formatGzip
+	case "application/x-bzip2":
+		return formatBzip2
+	case "application/zstd":
+		return formatZstd
+	case "application/zip", "application/x-zip-compressed":
+		return formatZip
+	case "application/x-tar":
+		return formatTar
+	}
+
+	return formatPlain
+}
+
+// trimExt drops the compression extension so the inner name can still be
+// detected, e.g. list.tar.gz becomes list.tar and list.tgz becomes list.tar.
+func trimExt(name string) string {
+	ext := path.Ext(name)
+	switch strings.ToLower(ext) {
+	case ".tgz", ".tbz2":
+		return strings.TrimSuffix(name, ext) + ".tar"
+	case ".gz", ".bz2", ".zst":
+		return strings.TrimSuffix(name, ext)
+	}
+	return name
+}
+
+func looksBinary(head []byte) bool {
+	return bytes.IndexByte(head, 0) >= 0
+}
@@ -0,0 +1,71 @@
+package providers
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func readLists(t *testing.T, o options, data []byte, name string) (map[string]string, error) {
+	t.Helper()
+	lists := make(map[string]string)
+	err := o.openLists(bytes.NewReader(data), name, "", func(name string, r io.Reader) error {
+		b, err := io.ReadAll(r)
+		lists[name] = string(b)
+		return err
+	})
+	return lists, err
+}
+
+func TestOpenListsSkipsBinaryMembers(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range map[string]string{
+		"list.txt": "1.2.3.4:80\n",
+		"logo.png": "\x89PNG\r\n\x1a\n\x00\x00",
+	} {
+		w, _ := zw.Create(name)
+		_, _ = w.Write([]byte(content))
+	}
+	_ = zw.Close()
+
+	lists, err := readLists(t, options{}, buf.Bytes(), "lists.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lists) != 1 || lists["list.txt"] != "1.2.3.4:80\n" {
+		t.Errorf("lists = %q, want only list.txt", lists)
+	}
+
+	if _, err := readLists(t, options{}, []byte("\x89PNG\r\n\x1a\n\x00\x00"), "logo.png"); !errors.Is(err, ErrBinaryContent) {
+		t.Errorf("top level binary: err = %v, want ErrBinaryContent", err)
+	}
+}
+
+func TestOpenListsSizeLimit(t *testing.T) {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	_, _ = gw.Write([]byte(strings.Repeat("1.2.3.4:80\n", 1000)))
+	_ = gw.Close()
+
+	lists, err := readLists(t, options{maxListSize: 110}, buf.Bytes(), "list.txt.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(lists["list.txt"]); got != 110 {
+		t.Errorf("read %d bytes, want 110", got)
+	}
+
+	var zbuf bytes.Buffer
+	zw := zip.NewWriter(&zbuf)
+	w, _ := zw.Create("list.txt")
+	_, _ = w.Write([]byte("1.2.3.4:80\n"))
+	_ = zw.Close()
+	if _, err := readLists(t, options{maxListSize: 16}, zbuf.Bytes(), "lists.zip"); !errors.Is(err, ErrListTooLarge) {
+		t.Errorf("oversized zip: err = %v, want ErrListTooLarge", err)
+	}
+}
@@ -0,0 +1,246 @@
+package providers
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/cenkalti/backoff/v5"
+	"github.com/yuridevx/proxylist/domain"
+	"github.com/yuridevx/proxylist/pkg/dedup"
+	"github.com/yuridevx/proxylist/pkg/netlist"
+	"github.com/yuridevx/proxylist/pkg/stats"
+	"github.com/yuridevx/proxylist/pkg/utils"
+)
+
+const (
+	// fetchViaAttempts is how many proxies are tried before a source is downloaded directly.
+	fetchViaAttempts = 3
+	// fetchViaTimeout bounds a download through a proxy when the provider has no timeout.
+	fetchViaTimeout = time.Minute
+)
+
+// fetchResult is a downloaded source body.
+// Changed is false when the server answered 304 or the body hash matches the
+// last fetch. The state of an unchanged source still carries the validators
+// the server sent this time, so it is committed as well.
+type fetchResult struct {
+	Body        []byte
+	ContentType string
+	Status      int
+	Changed     bool
+	state       dedup.SourceState
+}
+
+// fetch downloads source, sending a conditional request when the source was seen before.
+func (o *options) fetch(ctx context.Context, source string) (*fetchResult, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", source, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var prev dedup.SourceState
+	if o.cache != nil {
+		prev = o.cache.SourceState(source)
+		if prev.ETag != "" {
+			req.Header.Set("If-None-Match", prev.ETag)
+		}
+		if prev.LastModified != "" {
+			req.Header.Set("If-Modified-Since", prev.LastModified)
+		}
+	}
+
+	for k, v := range o.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := o.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		state := prev
+		state.ETag = cmp.Or(resp.Header.Get("ETag"), prev.ETag)
+		state.LastModified = cmp.Or(resp.Header.Get("Last-Modified"), prev.LastModified)
+		return &fetchResult{Status: resp.StatusCode, state: state}, nil
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	limit := o.listLimit()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("read body: %w", err)
+	}
+	if int64(len(body)) > limit {
+		return nil, fmt.Errorf("read body: %w", ErrListTooLarge)
+	}
+
+	sum := sha256.Sum256(body)
+	state := dedup.SourceState{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Hash:         hex.EncodeToString(sum[:]),
+	}
+
+	return &fetchResult{
+		Body:        body,
+		ContentType: resp.Header.Get("Content-Type"),
+		Status:      resp.StatusCode,
+		Changed:     o.cache == nil || state.Hash != prev.Hash,
+		state:       state,
+	}, nil
+}
+
+// do sends req through the configured proxies and falls back to a direct
+// request once fetchViaAttempts proxies failed or none are available.
+// A proxy fails on transport errors and on statuses saying the source
+// turned it away; any other answer is the source's own and is returned.
+// Plain http sources are always fetched directly, since any proxy could
+// rewrite them and inject entries of its own.
+func (o *options) do(ctx context.Context, req *http.Request) (*http.Response, error) {
+	if o.via != nil && req.URL.Scheme == "https" {
+		timeout := cmp.Or(o.timeout, fetchViaTimeout)
+		for i := 0; i < fetchViaAttempts; i++ {
+			client, addr, ok := o.via.Next(timeout)
+			if !ok {
+				break
+			}
+			resp, err := utils.DoWithRetry(ctx, client, req, backoff.NewExponentialBackOff())
+			if err == nil && !refused(resp.StatusCode) {
+				return resp, nil
+			}
+			if err == nil {
+				resp.Body.Close()
+			}
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			o.via.Drop(addr)
+		}
+	}
+	return utils.DoWithRetry(ctx, o.httpClient(), req, backoff.NewExponentialBackOff())
+}
+
+// refused reports whether status means the source turned the proxy away
+// rather than failing on its own.
+func refused(status int) bool {
+	switch status {
+	case http.StatusForbidden, http.StatusProxyAuthRequired, http.StatusTooManyRequests:
+		return true
+	}
+	return false
+}
+
+// emitter pushes entries into the sink, skipping entries already emitted
+// by the previous fetch when diff-only mode is enabled.
+type emitter struct {
+	sink     chan<- domain.ProvidedProxy
+	name     string
+	priority int
+	profile  string
+	filter   *netlist.Filter
+	prev     map[string]struct{}
+	current  map[string]struct{}
+	parsed   int
+	failed   int
+	rejected int
+}
+
+// newEmitter returns an emitter for source, loading the previous entry set in diff-only mode.
+func (o *options) newEmitter(source string, sink chan<- domain.ProvidedProxy) (*emitter, error) {
+	e := o.plainEmitter(sink)
+	if o.cache == nil || !o.diffOnly {
+		return e, nil
+	}
+	prev, err := o.cache.SourceEntries(source)
+	if err != nil {
+		return nil, err
+	}
+	e.prev = prev
+	e.current = make(map[string]struct{}, len(prev))
+	return e, nil
+}
+
+// plainEmitter returns an emitter that never skips entries.
+func (o *options) plainEmitter(sink chan<- domain.ProvidedProxy) *emitter {
+	return &emitter{sink: sink, name: o.name, priority: o.priority, profile: o.profile, filter: o.filter}
+}
+
+func (e *emitter) emit(ctx context.Context, p domain.ProvidedProxy) error {
+	if e.name != "" {
+		p.Provider = e.name
+	}
+	p.Priority = e.priority
+	p.Profile = e.profile
+	e.parsed++
+
+	if _, ok := e.filter.Allowed(p.IP); !ok {
+		e.rejected++
+		return nil
+	}
+
+	if e.current != nil {
+		key := string(p.Key())
+		e.current[key] = struct{}{}
+		if _, ok := e.prev[key]; ok {
+			return nil
+		}
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case e.sink <- p:
+	}
+	return nil
+}
+
+// fail counts an entry that could not be parsed.
+func (e *emitter) fail() {
+	e.failed++
+}
+
+// report records a finished reconcile of provider. res and em are nil when
+// the reconcile failed before fetching or parsing.
+func (o *options) report(provider string, started time.Time, res *fetchResult, em *emitter, err error) {
+	f := stats.Fetch{
+		Provider: provider,
+		Started:  started,
+		Duration: time.Since(started),
+		Err:      err,
+	}
+	if res != nil {
+		f.HTTPStatus = res.Status
+		f.Unchanged = err == nil && !res.Changed
+	}
+	if em != nil {
+		f.Parsed = em.parsed
+		f.ParseFailures = em.failed
+		f.Rejected = em.rejected
+	}
+	o.stats.RecordFetch(f)
+}
+
+// commit persists the fetch state and the emitted entry set once all
+// entries were emitted, so an interrupted reconcile emits the source again.
+// e is nil for an unchanged source, whose entry set stays as it is.
+func (o *options) commit(source string, res *fetchResult, e *emitter) error {
+	if o.cache == nil {
+		return nil
+	}
+	if e != nil && e.current != nil {
+		if err := o.cache.SaveSourceEntries(source, e.current); err != nil {
+			return err
+		}
+	}
+	return o.cache.SaveSourceState(source, res.state)
+}
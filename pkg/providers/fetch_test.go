@@ -0,0 +1,180 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yuridevx/proxylist/domain"
+	"github.com/yuridevx/proxylist/pkg/dedup"
+	"github.com/yuridevx/proxylist/pkg/stats"
+	"go.uber.org/zap"
+)
+
+// source serves body under etag and answers 304 to a matching If-None-Match.
+type source struct {
+	mu          sync.Mutex
+	body, etag  string
+	ifNoneMatch string
+}
+
+func (s *source) set(body, etag string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.body, s.etag = body, etag
+}
+
+func (s *source) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ifNoneMatch = r.Header.Get("If-None-Match")
+	w.Header().Set("ETag", s.etag)
+	if s.ifNoneMatch == s.etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	_, _ = w.Write([]byte(s.body))
+}
+
+func openCache(t *testing.T) *dedup.Deduplicator {
+	t.Helper()
+	cache, err := dedup.New(filepath.Join(t.TempDir(), "db.bolt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = cache.Close() })
+	return cache
+}
+
+func TestHostPortListConditionalDiff(t *testing.T) {
+	src := &source{}
+	srv := httptest.NewServer(src)
+	defer srv.Close()
+
+	cache := openCache(t)
+	collector := stats.NewCollector(nil, zap.NewNop())
+	sink := make(chan domain.ProvidedProxy, 16)
+	list := NewHostPortList(srv.URL+"/list.txt", WithSourceCache(cache), WithDiffOnly(true), WithStats(collector), WithName("test"))
+	list.Init(zap.NewNop(), sink)
+
+	reconcile := func() []string {
+		t.Helper()
+		if err := list.Reconcile(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		var emitted []string
+		for len(sink) > 0 {
+			emitted = append(emitted, string((<-sink).Key()))
+		}
+		slices.Sort(emitted)
+		return emitted
+	}
+	parsed := func() int {
+		return collector.Snapshot()[0].LastFetch.Parsed
+	}
+
+	tests := []struct {
+		name        string
+		body, etag  string
+		ifNoneMatch string
+		emitted     []string
+		parsed      int
+	}{
+		{"first fetch", "1.1.1.1:80\n2.2.2.2:80\n", `"a"`, "", []string{"1.1.1.1:80", "2.2.2.2:80"}, 2},
+		{"not modified", "1.1.1.1:80\n2.2.2.2:80\n", `"a"`, `"a"`, nil, 2},
+		// a new validator for the same body is stored although nothing is emitted
+		{"same hash", "1.1.1.1:80\n2.2.2.2:80\n", `"b"`, `"a"`, nil, 2},
+		{"new validator sent", "1.1.1.1:80\n2.2.2.2:80\n", `"b"`, `"b"`, nil, 2},
+		{"only new entries", "1.1.1.1:80\n2.2.2.2:80\n3.3.3.3:80\n", `"c"`, `"b"`, []string{"3.3.3.3:80"}, 3},
+		{"removed entries", "3.3.3.3:80\n", `"d"`, `"c"`, nil, 1},
+		{"readded entries", "1.1.1.1:80\n3.3.3.3:80\n", `"e"`, `"d"`, []string{"1.1.1.1:80"}, 2},
+	}
+	for _, tt := range tests {
+		src.set(tt.body, tt.etag)
+		emitted := reconcile()
+		if src.ifNoneMatch != tt.ifNoneMatch {
+			t.Errorf("%s: If-None-Match %s, want %s", tt.name, src.ifNoneMatch, tt.ifNoneMatch)
+		}
+		if !slices.Equal(emitted, tt.emitted) {
+			t.Errorf("%s: emitted %v, want %v", tt.name, emitted, tt.emitted)
+		}
+		if got := parsed(); got != tt.parsed {
+			t.Errorf("%s: parsed %d, want %d", tt.name, got, tt.parsed)
+		}
+	}
+}
+
+func TestFetchTooLarge(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("1.1.1.1:80\n2.2.2.2:80\n"))
+	}))
+	defer srv.Close()
+
+	o := options{maxListSize: 8}
+	if _, err := o.fetch(context.Background(), srv.URL); !errors.Is(err, ErrListTooLarge) {
+		t.Errorf("fetch = %v, want ErrListTooLarge", err)
+	}
+	o.maxListSize = 64
+	res, err := o.fetch(context.Background(), srv.URL)
+	if err != nil || !res.Changed || len(res.Body) != 22 {
+		t.Errorf("fetch = %+v, %v, want the whole body", res, err)
+	}
+}
+
+// rotator hands out client for every proxy and records the dropped ones.
+type rotator struct {
+	client  *http.Client
+	dropped int
+}
+
+func (r *rotator) Next(time.Duration) (*http.Client, string, bool) {
+	return r.client, "192.0.2.1:8080", true
+}
+
+func (r *rotator) Drop(string) {
+	r.dropped++
+}
+
+func TestFetchViaDropsRefusingProxies(t *testing.T) {
+	tests := []struct {
+		status  int
+		dropped int
+	}{
+		{http.StatusOK, 0},
+		{http.StatusNotFound, 0},
+		{http.StatusInternalServerError, 0},
+		{http.StatusForbidden, fetchViaAttempts},
+		{http.StatusProxyAuthRequired, fetchViaAttempts},
+	}
+	for _, tt := range tests {
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.status)
+		}))
+		// the direct fallback does not trust the test certificate
+		srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+		srv.StartTLS()
+		via := &rotator{client: srv.Client()}
+		o := options{via: via, timeout: time.Second}
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+
+		resp, err := o.do(context.Background(), req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		if via.dropped != tt.dropped {
+			t.Errorf("status %d: dropped %d proxies, want %d", tt.status, via.dropped, tt.dropped)
+		}
+		if tt.dropped == 0 && (err != nil || resp.StatusCode != tt.status) {
+			t.Errorf("status %d: do = %v, want the source's answer", tt.status, err)
+		}
+		srv.Close()
+	}
+}
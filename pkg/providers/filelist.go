@@ -0,0 +1,235 @@
+package providers
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/yuridevx/proxylist/domain"
+	"go.uber.org/zap"
+)
+
+// fileSettleDelay is how long a file must stay quiet after a write event
+// before it is parsed, so half-copied lists are not read.
+const fileSettleDelay = 2 * time.Second
+
+// FileList reads proxies from a local file or directory. Sources may be
+// plain paths or file:// URLs. Every Reconcile reads the whole source; a
+// directory is also watched for new and modified files in between, from
+// the first Reconcile on until its context is done.
+type FileList struct {
+	source string
+	path   string
+	opts   options
+	log    *zap.Logger
+	sink   chan<- domain.ProvidedProxy
+
+	// mu serializes the reconciles and the watcher
+	mu       sync.Mutex
+	seen     map[string]time.Time
+	watching bool
+}
+
+func NewFileList(source string, opts ...Option) *FileList {
+	return &FileList{
+		source: source,
+		path:   FilePath(source),
+		opts:   newOptions(opts),
+	}
+}
+
+// IsFileSource reports whether source refers to the local filesystem.
+func IsFileSource(source string) bool {
+	return strings.HasPrefix(source, "file://")
+}
+
+// FilePath strips the file:// scheme from source.
+func FilePath(source string) string {
+	return filepath.Clean(strings.TrimPrefix(source, "file://"))
+}
+
+func (ps *FileList) Init(log *zap.Logger, sink chan<- domain.ProvidedProxy) {
+	ps.log = log
+	ps.sink = sink
+}
+
+func (ps *FileList) Reconcile(ctx context.Context) error {
+	info, err := os.Stat(ps.path)
+	if err != nil {
+		ps.log.Error("Invalid file source", zap.String("source", ps.source), zap.Error(err))
+		return err
+	}
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	// every reconcile re-emits the whole source like the http providers do,
+	// seen only suppresses duplicate watcher events in between
+	ps.seen = make(map[string]time.Time)
+
+	if !info.IsDir() {
+		defer func() {
+			ps.log.Info("Reconciliation complete", zap.String("file", ps.path))
+		}()
+		return ps.processFile(ctx, ps.path)
+	}
+
+	if !ps.watching {
+		if err := ps.watchDir(ctx); err != nil {
+			return err
+		}
+	}
+
+	entries, err := os.ReadDir(ps.path)
+	if err != nil {
+		ps.log.Error("Read dir failed", zap.String("dir", ps.path), zap.Error(err))
+		return err
+	}
+	for _, entry := range entries {
+		if err := ps.processFile(ctx, filepath.Join(ps.path, entry.Name())); err != nil {
+			return err
+		}
+	}
+	ps.log.Info("Reconciliation complete", zap.String("dir", ps.path))
+	return nil
+}
+
+// watchDir starts watching the directory, so files created or modified
+// between reconciles are processed until ctx is done. The watch is set up
+// before the directory is read, so no file falls in between.
+func (ps *FileList) watchDir(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		ps.log.Error("Watcher creation failed", zap.Error(err))
+		return err
+	}
+	if err := watcher.Add(ps.path); err != nil {
+		_ = watcher.Close()
+		ps.log.Error("Watch failed", zap.String("dir", ps.path), zap.Error(err))
+		return err
+	}
+
+	ps.watching = true
+	go ps.watch(ctx, watcher)
+	ps.log.Info("Watching directory", zap.String("dir", ps.path))
+	return nil
+}
+
+func (ps *FileList) watch(ctx context.Context, watcher *fsnotify.Watcher) {
+	defer func() {
+		_ = watcher.Close()
+		ps.mu.Lock()
+		ps.watching = false
+		ps.mu.Unlock()
+	}()
+
+	pending := make(map[string]struct{})
+	settle := time.NewTimer(fileSettleDelay)
+	settle.Stop()
+	defer settle.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Has(fsnotify.Create) || event.Has(fsnotify.Write) || event.Has(fsnotify.Rename) {
+				pending[event.Name] = struct{}{}
+				settle.Reset(fileSettleDelay)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			ps.log.Warn("Watcher error", zap.String("dir", ps.path), zap.Error(err))
+		case <-settle.C:
+			ps.mu.Lock()
+			for name := range pending {
+				delete(pending, name)
+				if err := ps.processFile(ctx, name); err != nil {
+					ps.mu.Unlock()
+					return
+				}
+			}
+			ps.mu.Unlock()
+		}
+	}
+}
+
+// processFile parses a single file if it changed since it was last read.
+// Missing files and directories are ignored.
+func (ps *FileList) processFile(ctx context.Context, name string) error {
+	info, err := os.Stat(name)
+	if err != nil || info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+		return nil
+	}
+	if last, ok := ps.seen[name]; ok && last.Equal(info.ModTime()) {
+		return nil
+	}
+	ps.seen[name] = info.ModTime()
+
+	f, err := os.Open(name)
+	if err != nil {
+		ps.log.Warn("Open failed", zap.String("file", name), zap.Error(err))
+		return nil
+	}
+	defer f.Close()
+
+	ps.log.Debug("Parsing file", zap.String("file", name))
+
+	started := time.Now()
+	provider := cmp.Or(ps.opts.name, filepath.Base(ps.path))
+	em := ps.opts.plainEmitter(ps.sink)
+	err = ps.opts.openLists(f, name, "", func(list string, r io.Reader) error {
+		return ps.scan(ctx, r, em, name, provider)
+	})
+	ps.opts.report(provider, started, nil, em, err)
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	if err != nil {
+		ps.log.Warn("Scan error", zap.String("file", name), zap.Error(err))
+	}
+
+	return nil
+}
+
+// scan parses one plain text list in any format ParseEntry understands.
+func (ps *FileList) scan(ctx context.Context, r io.Reader, em *emitter, name, provider string) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		cleanedIP, portInt, err := ParseEntry(line)
+		if err != nil {
+			ps.log.Warn("Invalid entry", zap.String("file", name), zap.String("line", line), zap.Error(err))
+			em.fail()
+			continue
+		}
+
+		err = em.emit(ctx, domain.ProvidedProxy{
+			IP:       cleanedIP,
+			Port:     portInt,
+			Provider: provider,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
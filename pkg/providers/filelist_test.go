@@ -0,0 +1,55 @@
+package providers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/yuridevx/proxylist/domain"
+	"go.uber.org/zap"
+)
+
+func TestFileListDirectoryReconcile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("1.1.1.1:80\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sink := make(chan domain.ProvidedProxy, 16)
+	list := NewFileList("file://" + dir)
+	list.Init(zap.NewNop(), sink)
+
+	reconcile := func() int {
+		t.Helper()
+		done := make(chan error, 1)
+		go func() { done <- list.Reconcile(ctx) }()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("directory reconcile did not return")
+		}
+		n := len(sink)
+		for len(sink) > 0 {
+			<-sink
+		}
+		return n
+	}
+
+	if n := reconcile(); n != 1 {
+		t.Errorf("first reconcile emitted %d entries, want 1", n)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "b.txt"), []byte("2.2.2.2:80\n3.3.3.3:80\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// a triggered reconcile reads the whole directory again
+	if n := reconcile(); n != 3 {
+		t.Errorf("second reconcile emitted %d entries, want 3", n)
+	}
+}
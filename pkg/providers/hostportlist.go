@@ -2,25 +2,29 @@ package providers
 
 import (
 	"bufio"
+	"bytes"
+	"cmp"
 	"context"
-	"github.com/cenkalti/backoff/v5"
 	"github.com/yuridevx/proxylist/domain"
 	"github.com/yuridevx/proxylist/pkg/utils"
 	"go.uber.org/zap"
-	"net/http"
+	"io"
 	"net/url"
 	"strings"
+	"time"
 )
 
 type HostPortList struct {
 	source string
+	opts   options
 	log    *zap.Logger
 	sink   chan<- domain.ProvidedProxy
 }
 
-func NewHostPortList(source string) domain.ProxyProvider {
+func NewHostPortList(source string, opts ...Option) domain.ProxyProvider {
 	return &HostPortList{
 		source: source,
+		opts:   newOptions(opts),
 	}
 }
 
@@ -29,33 +33,62 @@ func (ps *HostPortList) Init(log *zap.Logger, sink chan<- domain.ProvidedProxy)
 	ps.sink = sink
 }
 
-func (ps *HostPortList) Reconcile(ctx context.Context) error {
+func (ps *HostPortList) Reconcile(ctx context.Context) (err error) {
 	parsedURL, err := url.Parse(ps.source)
 	if err != nil {
 		ps.log.Error("Invalid URL", zap.String("source", ps.source), zap.Error(err))
 		return err
 	}
 
+	var (
+		started = time.Now()
+		res     *fetchResult
+		em      *emitter
+	)
 	defer func() {
+		ps.opts.report(cmp.Or(ps.opts.name, parsedURL.Host), started, res, em, err)
 		ps.log.Info("Reconciliation complete", zap.String("host", parsedURL.Host))
 	}()
 
 	ps.log.Debug("Starting reconciliation", zap.String("host", parsedURL.Host))
 
-	req, err := http.NewRequestWithContext(ctx, "GET", ps.source, nil)
+	res, err = ps.opts.fetch(ctx, ps.source)
 	if err != nil {
-		ps.log.Error("Request creation failed", zap.Error(err))
+		ps.log.Error("Fetch failed", zap.Error(err))
 		return err
 	}
+	if !res.Changed {
+		ps.log.Info("Source unchanged", zap.String("host", parsedURL.Host))
+		if err := ps.opts.commit(ps.source, res, nil); err != nil {
+			ps.log.Warn("Saving source state failed", zap.Error(err))
+		}
+		return nil
+	}
 
-	resp, err := utils.DoWithRetry(ctx, http.DefaultClient, req, backoff.NewExponentialBackOff())
+	em, err = ps.opts.newEmitter(ps.source, ps.sink)
 	if err != nil {
-		ps.log.Error("Fetch failed", zap.Error(err))
+		ps.log.Error("Loading previous entries failed", zap.Error(err))
+		return err
+	}
+
+	err = ps.opts.openLists(bytes.NewReader(res.Body), parsedURL.Path, res.ContentType, func(name string, r io.Reader) error {
+		return ps.scan(ctx, r, em, parsedURL.Host)
+	})
+	if err != nil {
+		ps.log.Error("Scan error", zap.Error(err))
 		return err
 	}
-	defer resp.Body.Close()
 
-	scanner := bufio.NewScanner(resp.Body)
+	if err := ps.opts.commit(ps.source, res, em); err != nil {
+		ps.log.Warn("Saving source state failed", zap.Error(err))
+	}
+
+	return nil
+}
+
+// scan parses one plain text host:port list.
+func (ps *HostPortList) scan(ctx context.Context, r io.Reader, em *emitter, provider string) error {
+	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
 		if line == "" {
@@ -65,24 +98,19 @@ func (ps *HostPortList) Reconcile(ctx context.Context) error {
 		cleanedIP, portInt, err := utils.CleanHostPort(line)
 		if err != nil {
 			ps.log.Warn("Invalid IP", zap.String("host", line), zap.Error(err))
+			em.fail()
 			continue
 		}
 
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case ps.sink <- domain.ProvidedProxy{
+		err = em.emit(ctx, domain.ProvidedProxy{
 			IP:       cleanedIP,
 			Port:     portInt,
-			Provider: parsedURL.Host,
-		}:
+			Provider: provider,
+		})
+		if err != nil {
+			return err
 		}
 	}
 
-	if err := scanner.Err(); err != nil {
-		ps.log.Error("Scan error", zap.Error(err))
-		return err
-	}
-
-	return nil
+	return scanner.Err()
 }
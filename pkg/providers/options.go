@@ -0,0 +1,132 @@
+package providers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/yuridevx/proxylist/pkg/dedup"
+	"github.com/yuridevx/proxylist/pkg/netlist"
+	"github.com/yuridevx/proxylist/pkg/stats"
+)
+
+// Option configures a provider.
+type Option func(*options)
+
+type options struct {
+	cache       *dedup.Deduplicator
+	diffOnly    bool
+	name        string
+	priority    int
+	profile     string
+	timeout     time.Duration
+	headers     map[string]string
+	via         ProxyRotator
+	stats       *stats.Collector
+	filter      *netlist.Filter
+	maxListSize int64
+}
+
+// ProxyRotator hands out http clients routed through other proxies.
+type ProxyRotator interface {
+	Next(timeout time.Duration) (client *http.Client, addr string, ok bool)
+	Drop(addr string)
+}
+
+// WithSourceCache enables conditional fetching. ETag, Last-Modified and a
+// body hash are persisted per source and an unchanged source is not emitted.
+func WithSourceCache(cache *dedup.Deduplicator) Option {
+	return func(o *options) {
+		o.cache = cache
+	}
+}
+
+// WithDiffOnly emits only entries that were not present in the previous
+// fetch of the same source. It requires WithSourceCache.
+func WithDiffOnly(diffOnly bool) Option {
+	return func(o *options) {
+		o.diffOnly = diffOnly
+	}
+}
+
+// WithName overrides the provider name attached to emitted proxies.
+func WithName(name string) Option {
+	return func(o *options) {
+		o.name = name
+	}
+}
+
+// WithPriority sets the priority attached to emitted proxies.
+func WithPriority(priority int) Option {
+	return func(o *options) {
+		o.priority = priority
+	}
+}
+
+// WithProfile sets the check profile attached to emitted proxies.
+func WithProfile(profile string) Option {
+	return func(o *options) {
+		o.profile = profile
+	}
+}
+
+// WithTimeout bounds a single source download.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// WithHeaders adds request headers to every source download.
+func WithHeaders(headers map[string]string) Option {
+	return func(o *options) {
+		o.headers = headers
+	}
+}
+
+// WithFetchVia downloads https sources through proxies handed out by via,
+// falling back to a direct download when they keep failing. Plain http
+// sources are downloaded directly.
+func WithFetchVia(via ProxyRotator) Option {
+	return func(o *options) {
+		o.via = via
+	}
+}
+
+// WithStats records every reconcile in c.
+func WithStats(c *stats.Collector) Option {
+	return func(o *options) {
+		o.stats = c
+	}
+}
+
+// WithAddressFilter drops parsed entries whose address the filter rejects,
+// before they reach the sink.
+func WithAddressFilter(f *netlist.Filter) Option {
+	return func(o *options) {
+		o.filter = f
+	}
+}
+
+// WithMaxListSize caps every download, list, archive member and zip archive
+// read from a source at n bytes. Longer lists are cut off, larger downloads
+// and zip archives fail.
+func WithMaxListSize(n int64) Option {
+	return func(o *options) {
+		o.maxListSize = n
+	}
+}
+
+func newOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+func (o *options) httpClient() *http.Client {
+	if o.timeout <= 0 {
+		return http.DefaultClient
+	}
+	return &http.Client{Timeout: o.timeout}
+}
@@ -0,0 +1,69 @@
+package providers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/yuridevx/proxylist/pkg/utils"
+)
+
+// ParseEntry auto-detects the format of a single list line and returns the
+// cleaned IP and port. Supported formats are plain host:port, proxy URLs
+// (socks5://1.2.3.4:1080) and CSV rows with either a host:port column or
+// separate ip and port columns.
+func ParseEntry(line string) (string, int, error) {
+	switch {
+	case strings.Contains(line, "://"):
+		u, err := url.Parse(line)
+		if err != nil {
+			return "", 0, err
+		}
+		return utils.CleanHostPort(u.Host)
+	case strings.ContainsAny(line, ",;\t"):
+		return parseCSV(line)
+	default:
+		return utils.CleanHostPort(line)
+	}
+}
+
+func parseCSV(line string) (string, int, error) {
+	r := csv.NewReader(strings.NewReader(line))
+	r.Comma = detectComma(line)
+	r.LazyQuotes = true
+	fields, err := r.Read()
+	if err != nil {
+		return "", 0, err
+	}
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+
+	// a single ip:port column
+	for _, field := range fields {
+		if strings.Contains(field, ":") {
+			if ip, port, err := ParseEntry(field); err == nil {
+				return ip, port, nil
+			}
+		}
+	}
+
+	// ip column followed by a port column
+	for i := 0; i+1 < len(fields); i++ {
+		if ip, port, err := utils.CleanHostPort(fields[i] + ":" + fields[i+1]); err == nil {
+			return ip, port, nil
+		}
+	}
+
+	return "", 0, fmt.Errorf("no ip:port in csv row")
+}
+
+func detectComma(line string) rune {
+	for _, c := range []rune{',', ';', '\t'} {
+		if strings.ContainsRune(line, c) {
+			return c
+		}
+	}
+	return ','
+}
@@ -0,0 +1,56 @@
+package providers
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/yuridevx/proxylist/domain"
+	"github.com/yuridevx/proxylist/pkg/config"
+)
+
+// New builds the provider described by pc. The options from pc are
+// applied after opts, so per-provider settings win over global ones.
+// Emitted proxies are tagged with Name(pc).
+func New(pc config.ProviderConfig, opts ...Option) (domain.ProxyProvider, error) {
+	opts = append(opts,
+		WithName(Name(pc)),
+		WithPriority(pc.Priority),
+		WithProfile(pc.Profile),
+		WithTimeout(pc.Timeout),
+		WithHeaders(pc.Headers),
+	)
+
+	if IsFileSource(pc.Source) {
+		return NewFileList(pc.Source, opts...), nil
+	}
+
+	switch pc.Type {
+	case config.ProviderHostPort:
+		return NewHostPortList(pc.Source, opts...), nil
+	case config.ProviderUrl:
+		return NewUrlProxyList(pc.Source, opts...), nil
+	case config.ProviderFile:
+		return NewFileList(pc.Source, opts...), nil
+	default:
+		return nil, fmt.Errorf("unknown provider type %q", pc.Type)
+	}
+}
+
+// Name returns the provider name used for emitted proxies, statistics,
+// quarantine and the test queue. Unnamed sources are named after their
+// host and path, so several lists on one host are kept apart.
+func Name(pc config.ProviderConfig) string {
+	if pc.Name != "" {
+		return pc.Name
+	}
+	if IsFileSource(pc.Source) || pc.Type == config.ProviderFile {
+		return filepath.Base(FilePath(pc.Source))
+	}
+	u, err := url.Parse(pc.Source)
+	if err != nil || u.Host == "" {
+		return pc.Source
+	}
+	return u.Host + strings.TrimSuffix(u.Path, "/")
+}
@@ -2,25 +2,29 @@ package providers
 
 import (
 	"bufio"
+	"bytes"
+	"cmp"
 	"context"
-	"github.com/cenkalti/backoff/v5"
 	"github.com/yuridevx/proxylist/domain"
 	"github.com/yuridevx/proxylist/pkg/utils"
 	"go.uber.org/zap"
-	"net/http"
+	"io"
 	"net/url"
 	"strings"
+	"time"
 )
 
 type UrlList struct {
 	source string
+	opts   options
 	log    *zap.Logger
 	sink   chan<- domain.ProvidedProxy
 }
 
-func NewUrlProxyList(source string) *UrlList {
+func NewUrlProxyList(source string, opts ...Option) *UrlList {
 	return &UrlList{
 		source: source,
+		opts:   newOptions(opts),
 	}
 }
 
@@ -29,7 +33,7 @@ func (ps *UrlList) Init(log *zap.Logger, sink chan<- domain.ProvidedProxy) {
 	ps.sink = sink
 }
 
-func (ps *UrlList) Reconcile(ctx context.Context) error {
+func (ps *UrlList) Reconcile(ctx context.Context) (err error) {
 	parsedUrl, err := url.Parse(ps.source)
 	if err != nil {
 		ps.log.Error("Invalid source URL", zap.String("source", ps.source), zap.Error(err))
@@ -37,24 +41,53 @@ func (ps *UrlList) Reconcile(ctx context.Context) error {
 	}
 	host := parsedUrl.Host
 
+	var (
+		started = time.Now()
+		res     *fetchResult
+		em      *emitter
+	)
 	defer func() {
+		ps.opts.report(cmp.Or(ps.opts.name, host), started, res, em, err)
 		ps.log.Info("Reconciliation complete", zap.String("host", host))
 	}()
 
-	req, err := http.NewRequest("GET", ps.source, nil)
+	res, err = ps.opts.fetch(ctx, ps.source)
 	if err != nil {
-		ps.log.Error("Request creation failed", zap.String("host", host), zap.Error(err))
+		ps.log.Error("Fetch failed", zap.String("host", host), zap.Error(err))
 		return err
 	}
+	if !res.Changed {
+		ps.log.Info("Source unchanged", zap.String("host", host))
+		if err := ps.opts.commit(ps.source, res, nil); err != nil {
+			ps.log.Warn("Saving source state failed", zap.String("host", host), zap.Error(err))
+		}
+		return nil
+	}
 
-	resp, err := utils.DoWithRetry(ctx, http.DefaultClient, req, backoff.NewExponentialBackOff())
+	em, err = ps.opts.newEmitter(ps.source, ps.sink)
 	if err != nil {
-		ps.log.Error("Fetch failed", zap.String("host", host), zap.Error(err))
+		ps.log.Error("Loading previous entries failed", zap.String("host", host), zap.Error(err))
+		return err
+	}
+
+	err = ps.opts.openLists(bytes.NewReader(res.Body), parsedUrl.Path, res.ContentType, func(name string, r io.Reader) error {
+		return ps.scan(ctx, r, em, host)
+	})
+	if err != nil {
+		ps.log.Error("Scan error", zap.String("host", host), zap.Error(err))
 		return err
 	}
-	defer resp.Body.Close()
 
-	scanner := bufio.NewScanner(resp.Body)
+	if err := ps.opts.commit(ps.source, res, em); err != nil {
+		ps.log.Warn("Saving source state failed", zap.String("host", host), zap.Error(err))
+	}
+
+	return nil
+}
+
+// scan parses one plain text list of proxy URLs.
+func (ps *UrlList) scan(ctx context.Context, r io.Reader, em *emitter, host string) error {
+	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
 		if line == "" {
@@ -64,30 +97,26 @@ func (ps *UrlList) Reconcile(ctx context.Context) error {
 		proxyUrl, err := url.Parse(line)
 		if err != nil {
 			ps.log.Warn("Parse failed", zap.String("host", host), zap.Error(err))
+			em.fail()
 			continue
 		}
 
 		cleanedIP, portInt, err := utils.CleanHostPort(proxyUrl.Host)
 		if err != nil {
 			ps.log.Warn("Invalid IP address after cleaning", zap.String("host", host), zap.Error(err))
+			em.fail()
 			continue
 		}
 
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case ps.sink <- domain.ProvidedProxy{
+		err = em.emit(ctx, domain.ProvidedProxy{
 			IP:       cleanedIP,
 			Port:     portInt,
 			Provider: host,
-		}:
+		})
+		if err != nil {
+			return err
 		}
 	}
 
-	if err := scanner.Err(); err != nil {
-		ps.log.Error("Scan error", zap.String("host", host), zap.Error(err))
-		return err
-	}
-
-	return nil
+	return scanner.Err()
 }
@@ -0,0 +1,107 @@
+package proxypool
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yuridevx/proxylist/pkg/models"
+	"go.uber.org/zap"
+	"h12.io/socks"
+)
+
+// Pool hands out already validated proxies from proxy_info in round robin
+// order, so provider sources can be fetched without exposing our own IP.
+type Pool struct {
+	db     *pgxpool.Pool
+	log    *zap.Logger
+	maxAge time.Duration
+	size   int32
+
+	mu      sync.Mutex
+	proxies []models.ListHealthyProxiesRow
+	next    int
+}
+
+// NewPool creates a pool of at most size proxies tested within maxAge.
+func NewPool(db *pgxpool.Pool, log *zap.Logger, maxAge time.Duration, size int) *Pool {
+	return &Pool{
+		db:     db,
+		log:    log,
+		maxAge: maxAge,
+		size:   int32(size),
+	}
+}
+
+// Refresh reloads the healthy proxies from the database.
+func (p *Pool) Refresh(ctx context.Context) error {
+	rows, err := models.New(p.db).ListHealthyProxies(ctx, models.ListHealthyProxiesParams{
+		TestedAt: pgtype.Timestamp{
+			Time:  time.Now().Add(-p.maxAge),
+			Valid: true,
+		},
+		Limit: p.size,
+	})
+	if err != nil {
+		p.log.Error("Loading healthy proxies failed", zap.Error(err))
+		return err
+	}
+
+	p.mu.Lock()
+	p.proxies = rows
+	p.next = 0
+	p.mu.Unlock()
+
+	p.log.Debug("Proxy pool refreshed", zap.Int("proxies", len(rows)))
+	return nil
+}
+
+// Next returns a client routed through the next proxy in rotation and the
+// proxy address. ok is false when the pool is empty.
+func (p *Pool) Next(timeout time.Duration) (client *http.Client, addr string, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.proxies) == 0 {
+		return nil, "", false
+	}
+	row := p.proxies[p.next%len(p.proxies)]
+	p.next++
+
+	addr = fmt.Sprintf("%s:%d", row.Ip, row.Port)
+	return &http.Client{Transport: transport(row.Protocol, addr, timeout), Timeout: timeout}, addr, true
+}
+
+// Drop removes a proxy that failed from the rotation until the next Refresh.
+func (p *Pool) Drop(addr string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, row := range p.proxies {
+		if fmt.Sprintf("%s:%d", row.Ip, row.Port) == addr {
+			p.proxies = append(p.proxies[:i], p.proxies[i+1:]...)
+			return
+		}
+	}
+}
+
+func transport(proto, addr string, timeout time.Duration) *http.Transport {
+	// certificates are verified, a proxy must not be able to rewrite the lists it carries.
+	// A source is fetched with a single request, so no idle connection is kept around.
+	tr := &http.Transport{DisableKeepAlives: true}
+	if proto == "http" || proto == "https" {
+		tr.Proxy = http.ProxyURL(&url.URL{Scheme: "http", Host: addr})
+		return tr
+	}
+	dial := socks.Dial(fmt.Sprintf("%s://%s?timeout=%s", proto, addr, timeout))
+	tr.DialContext = func(_ context.Context, network, addr string) (net.Conn, error) {
+		return dial(network, addr)
+	}
+	return tr
+}
@@ -0,0 +1,164 @@
+package proxytest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yuridevx/proxylist/pkg/config"
+	"go.uber.org/zap"
+)
+
+// resources is a sample of the local resource usage.
+type resources struct {
+	fds      int
+	fdLimit  int
+	cpuTime  time.Duration
+	sampleAt time.Time
+}
+
+// concurrency decides how many of the started workers may pick up proxies.
+// Every interval it shrinks the limit by a quarter when file descriptors,
+// goroutines or CPU are over their bound, or check timeouts were over theirs
+// for TimeoutWindows intervals in a row, and otherwise grows it while all
+// allowed workers are busy.
+type concurrency struct {
+	conf config.ConcurrencyConfig
+	log  *zap.Logger
+
+	limit    atomic.Int64
+	busy     atomic.Int64
+	checks   atomic.Int64
+	timeouts atomic.Int64
+
+	mu      sync.Mutex
+	changed chan struct{}
+	last    resources
+	// timeoutWindows counts the consecutive intervals over MaxTimeoutRatio.
+	timeoutWindows int
+}
+
+func newConcurrency(conf config.ConcurrencyConfig, log *zap.Logger, initial int) *concurrency {
+	c := &concurrency{
+		conf:    conf,
+		log:     log,
+		changed: make(chan struct{}),
+		last:    sampleResources(),
+	}
+	c.limit.Store(int64(min(max(initial, conf.Min), conf.Max)))
+	return c
+}
+
+// wait blocks worker id until it is within the limit. It returns false when ctx is done.
+func (c *concurrency) wait(ctx context.Context, id int) bool {
+	for {
+		c.mu.Lock()
+		changed := c.changed
+		c.mu.Unlock()
+
+		if int64(id) < c.limit.Load() {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-changed:
+		}
+	}
+}
+
+// record counts a finished check and whether it ran into a timeout.
+func (c *concurrency) record(err error) {
+	c.checks.Add(1)
+	if isTimeout(err) {
+		c.timeouts.Add(1)
+	}
+}
+
+func (c *concurrency) run(ctx context.Context) {
+	ticker := time.NewTicker(c.conf.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.adjust()
+		}
+	}
+}
+
+func (c *concurrency) adjust() {
+	now := sampleResources()
+	checks, timeouts := c.checks.Swap(0), c.timeouts.Swap(0)
+
+	var fdRatio, timeoutRatio, cpu float64
+	if now.fdLimit > 0 {
+		fdRatio = float64(now.fds) / float64(now.fdLimit)
+	}
+	if checks > 0 {
+		timeoutRatio = float64(timeouts) / float64(checks)
+	}
+	if wall := now.sampleAt.Sub(c.last.sampleAt); wall > 0 && now.cpuTime > 0 {
+		cpu = float64(now.cpuTime-c.last.cpuTime) / float64(wall) / float64(runtime.NumCPU())
+	}
+	goroutines := runtime.NumGoroutine()
+	c.last = now
+	if timeoutRatio > c.conf.MaxTimeoutRatio {
+		c.timeoutWindows++
+	} else {
+		c.timeoutWindows = 0
+	}
+
+	limit := c.limit.Load()
+	next := limit
+	var reason string
+	switch {
+	case fdRatio > c.conf.MaxFDRatio:
+		reason = "file descriptors"
+	case goroutines > c.conf.MaxGoroutines:
+		reason = "goroutines"
+	case c.timeoutWindows >= c.conf.TimeoutWindows:
+		reason = "timeouts"
+	case cpu > c.conf.MaxCPU:
+		reason = "cpu"
+	}
+	if reason != "" {
+		next = max(limit*3/4, int64(c.conf.Min))
+		c.timeoutWindows = 0
+	} else if c.busy.Load() >= limit {
+		next = min(limit+max(limit/10, 1), int64(c.conf.Max))
+	}
+	if next == limit {
+		return
+	}
+
+	c.log.Debug("adjusting proxy check concurrency",
+		zap.Int64("from", limit),
+		zap.Int64("to", next),
+		zap.String("pressure", reason),
+		zap.Float64("fd_ratio", fdRatio),
+		zap.Int("goroutines", goroutines),
+		zap.Float64("timeout_ratio", timeoutRatio),
+		zap.Float64("cpu", cpu),
+	)
+	c.limit.Store(next)
+
+	c.mu.Lock()
+	close(c.changed)
+	c.changed = make(chan struct{})
+	c.mu.Unlock()
+}
+
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,52 @@
+package proxytest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/yuridevx/proxylist/pkg/config"
+	"go.uber.org/zap"
+)
+
+func TestConcurrencyTimeoutWindows(t *testing.T) {
+	conf := config.ConcurrencyConfig{
+		Min:             1,
+		Max:             100,
+		MaxFDRatio:      1,
+		MaxGoroutines:   1 << 30,
+		MaxTimeoutRatio: 0.5,
+		TimeoutWindows:  3,
+		MaxCPU:          1 << 10,
+	}
+	c := newConcurrency(conf, zap.NewNop(), 40)
+	window := func(timeouts, checks int) int64 {
+		for i := 0; i < checks; i++ {
+			var err error
+			if i < timeouts {
+				err = context.DeadlineExceeded
+			}
+			c.record(err)
+		}
+		c.adjust()
+		return c.limit.Load()
+	}
+
+	tests := []struct {
+		name             string
+		timeouts, checks int
+		limit            int64
+	}{
+		{"one window of timeouts", 9, 10, 40},
+		{"a quiet window resets", 1, 10, 40},
+		{"first window again", 9, 10, 40},
+		{"second window", 9, 10, 40},
+		{"third window", 9, 10, 30},
+		// the streak starts over after a shrink
+		{"after the shrink", 9, 10, 30},
+	}
+	for _, tt := range tests {
+		if got := window(tt.timeouts, tt.checks); got != tt.limit {
+			t.Errorf("%s: limit %d, want %d", tt.name, got, tt.limit)
+		}
+	}
+}
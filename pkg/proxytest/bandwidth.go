@@ -0,0 +1,88 @@
+package proxytest
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"net/http"
+	"time"
+)
+
+// BandwidthTest downloads DownloadURL and, when UploadURL is set, uploads
+// UploadSize random bytes to it through a working proxy.
+type BandwidthTest struct {
+	DownloadURL string
+	UploadURL   string
+	UploadSize  int
+}
+
+// Throughput is the transfer rate through a proxy in KB/s, zero when the
+// direction was not measured or failed.
+type Throughput struct {
+	DownloadKBps float64
+	UploadKBps   float64
+}
+
+func (pc *ProxyChecker) measureThroughput(ctx context.Context, proto Protocol, proxyAddr string) Throughput {
+	var t Throughput
+	client := pc.proxyClient(proto, proxyAddr)
+
+	if pc.Bandwidth.DownloadURL != "" && pc.Limits.Wait(ctx, pc.Bandwidth.DownloadURL) == nil {
+		t.DownloadKBps = download(ctx, client, pc.Bandwidth.DownloadURL)
+	}
+	if pc.Bandwidth.UploadURL != "" && pc.Bandwidth.UploadSize > 0 && pc.Limits.Wait(ctx, pc.Bandwidth.UploadURL) == nil {
+		t.UploadKBps = upload(ctx, client, pc.Bandwidth.UploadURL, pc.Bandwidth.UploadSize)
+	}
+	return t
+}
+
+// download times the body only, so connection setup and the judge's
+// response time do not count against the rate.
+func download(ctx context.Context, client *http.Client, target string) float64 {
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return 0
+	}
+
+	start := time.Now()
+	n, err := io.Copy(io.Discard, resp.Body)
+	if err != nil {
+		return 0
+	}
+	return kBps(n, time.Since(start))
+}
+
+// upload times the whole request since the body is sent before the response.
+func upload(ctx context.Context, client *http.Client, target string, size int) float64 {
+	payload := make([]byte, size)
+	_, _ = rand.Read(payload)
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return 0
+	}
+	return kBps(int64(size), time.Since(start))
+}
+
+// kBps is the rate of n bytes in d in KB/s.
+func kBps(n int64, d time.Duration) float64 {
+	if n == 0 || d <= 0 {
+		return 0
+	}
+	return float64(n) / 1024 / d.Seconds()
+}
@@ -0,0 +1,28 @@
+package proxytest
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+
+	"h12.io/socks"
+)
+
+// proxyClient returns a client sending every request through the proxy
+// over proto, for the measurements run after the protocol checks.
+func (pc *ProxyChecker) proxyClient(proto Protocol, proxyAddr string) *http.Client {
+	tr := &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, DisableKeepAlives: true}
+	switch proto {
+	case ProtoHTTP, ProtoHTTPS:
+		tr.Proxy = http.ProxyURL(&url.URL{Scheme: "http", Host: proxyAddr})
+	default:
+		dial := socks.Dial(fmt.Sprintf("%s://%s?timeout=%s", proto, proxyAddr, pc.Timeout))
+		tr.DialContext = func(_ context.Context, network, addr string) (net.Conn, error) {
+			return dial(network, addr)
+		}
+	}
+	return &http.Client{Transport: tr, Timeout: pc.Timeout}
+}
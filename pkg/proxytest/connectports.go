@@ -0,0 +1,118 @@
+package proxytest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"h12.io/socks"
+)
+
+// ConnectPortsTest opens a tunnel through the proxy to Host on each of Ports.
+// When Echo is set, Host must echo what it receives and a port only counts
+// once a probe made the round trip, which catches proxies that answer
+// CONNECT but never forward anything.
+type ConnectPortsTest struct {
+	Host  string
+	Ports []int
+	Echo  bool
+}
+
+// measureConnectPorts returns the ports the proxy tunnels to, in ascending
+// order and empty rather than nil when it tunnels to none.
+func (pc *ProxyChecker) measureConnectPorts(ctx context.Context, proto Protocol, proxyAddr string) []int {
+	var (
+		mu      sync.Mutex
+		allowed = []int{}
+		wg      sync.WaitGroup
+	)
+	for _, port := range pc.ConnectPorts.Ports {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if pc.tunnelWorks(ctx, proto, proxyAddr, port) {
+				mu.Lock()
+				allowed = append(allowed, port)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	slices.Sort(allowed)
+	return allowed
+}
+
+func (pc *ProxyChecker) tunnelWorks(ctx context.Context, proto Protocol, proxyAddr string, port int) bool {
+	ctx, cancel := context.WithTimeout(ctx, pc.Timeout)
+	defer cancel()
+
+	target := net.JoinHostPort(pc.ConnectPorts.Host, strconv.Itoa(port))
+	conn, err := pc.tunnel(ctx, proto, proxyAddr, target)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+
+	if !pc.ConnectPorts.Echo {
+		return true
+	}
+	deadline, _ := ctx.Deadline()
+	_ = conn.SetDeadline(deadline)
+
+	probe := []byte(fmt.Sprintf("proxylist-%d-%d\n", port, time.Now().UnixNano()))
+	if _, err := conn.Write(probe); err != nil {
+		return false
+	}
+	reply := make([]byte, len(probe))
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return false
+	}
+	return bytes.Equal(reply, probe)
+}
+
+// tunnel opens a raw connection to target through the proxy.
+func (pc *ProxyChecker) tunnel(ctx context.Context, proto Protocol, proxyAddr, target string) (net.Conn, error) {
+	if proto != ProtoHTTP && proto != ProtoHTTPS {
+		dial := socks.Dial(fmt.Sprintf("%s://%s?timeout=%s", proto, proxyAddr, pc.Timeout))
+		return dial("tcp", target)
+	}
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+	deadline, _ := ctx.Deadline()
+	_ = conn.SetDeadline(deadline)
+
+	req := fmt.Sprintf("CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", target, target)
+	if _, err := io.WriteString(conn, req); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	// the body of a CONNECT response is the tunnel itself, so it is not read or closed
+	if resp.StatusCode != http.StatusOK {
+		_ = conn.Close()
+		return nil, fmt.Errorf("CONNECT %s: %s", target, resp.Status)
+	}
+	if br.Buffered() > 0 {
+		// the proxy must not send anything after the status before we do
+		_ = conn.Close()
+		return nil, fmt.Errorf("CONNECT %s: unexpected data after response", target)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return conn, nil
+}
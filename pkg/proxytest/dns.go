@@ -0,0 +1,51 @@
+package proxytest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"slices"
+)
+
+// DNSJudge hands out unique hostnames and reports who resolved them.
+type DNSJudge interface {
+	NewName() string
+	URL(name string) string
+	Resolvers(name string) []string
+	IsLocal(resolver string) bool
+}
+
+// DNSResult tells how a proxy resolves hostnames. RemoteDNS means the
+// proxy looked up a name it was given; Leak means the lookup came from a
+// resolver of this host instead, as SOCKS4 always requires.
+type DNSResult struct {
+	Tested    bool
+	RemoteDNS bool
+	Leak      bool
+}
+
+// measureDNS requests a fresh judge name through the proxy and looks at
+// which resolvers asked the judge for it.
+func (pc *ProxyChecker) measureDNS(ctx context.Context, proto Protocol, proxyAddr string) DNSResult {
+	name := pc.DNSJudge.NewName()
+	target := pc.DNSJudge.URL(name)
+
+	client := pc.proxyClient(proto, proxyAddr)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	resp, err := client.Do(req)
+	reached := err == nil
+	if reached {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		reached = resp.StatusCode == http.StatusOK
+	}
+
+	if ctx.Err() != nil {
+		return DNSResult{}
+	}
+
+	res := DNSResult{Tested: true}
+	res.Leak = proto == ProtoSOCKS4 || slices.ContainsFunc(pc.DNSJudge.Resolvers(name), pc.DNSJudge.IsLocal)
+	res.RemoteDNS = reached && !res.Leak
+	return res
+}
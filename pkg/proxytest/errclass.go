@@ -0,0 +1,167 @@
+package proxytest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+)
+
+// EndpointProtocol names failures of the endpoint itself, before any proxy
+// protocol could be tried.
+const EndpointProtocol = "tcp"
+
+// ErrorClass is the stable category of a failed check. Refused and Timeout
+// mean the proxy is dead, BadGateway that it is alive but could not reach
+// the target, Judge that the target itself misbehaved.
+type ErrorClass uint8
+
+const (
+	ClassNone ErrorClass = iota
+	ClassRefused
+	ClassTimeout
+	ClassTLS
+	ClassProxyAuth
+	ClassBadGateway
+	ClassProtocolMismatch
+	ClassJudge
+	ClassDNS
+	ClassOther
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case ClassNone:
+		return "none"
+	case ClassRefused:
+		return "connection_refused"
+	case ClassTimeout:
+		return "timeout"
+	case ClassTLS:
+		return "tls"
+	case ClassProxyAuth:
+		return "proxy_auth"
+	case ClassBadGateway:
+		return "bad_gateway"
+	case ClassProtocolMismatch:
+		return "protocol_mismatch"
+	case ClassJudge:
+		return "judge"
+	case ClassDNS:
+		return "dns"
+	default:
+		return "other"
+	}
+}
+
+// Failure is a failed check of one protocol.
+type Failure struct {
+	Proto Protocol
+	Class ErrorClass
+	Err   error
+}
+
+// StatusError is an HTTP status from the judge or the proxy in front of it
+// that fails a check.
+type StatusError struct {
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d %s", e.Code, http.StatusText(e.Code))
+}
+
+// checkStatus fails responses that say the request never got a proper
+// answer: proxy authentication, gateway errors and judge failures.
+func checkStatus(resp *http.Response) error {
+	if resp.StatusCode == http.StatusProxyAuthRequired || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return &StatusError{Code: resp.StatusCode}
+	}
+	return nil
+}
+
+// Classify maps a check error to its class. Errors of the SOCKS library and
+// of failed HTTP CONNECTs are plain strings, so those are matched by text.
+func Classify(err error) ErrorClass {
+	if err == nil {
+		return ClassNone
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return ClassDNS
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EHOSTUNREACH) || errors.Is(err, syscall.ENETUNREACH) {
+		return ClassRefused
+	}
+	if isTimeout(err) {
+		return ClassTimeout
+	}
+
+	var (
+		statusErr *StatusError
+		headerErr tls.RecordHeaderError
+		alertErr  tls.AlertError
+		verifyErr *tls.CertificateVerificationError
+		unknownCA x509.UnknownAuthorityError
+		syntaxErr *json.SyntaxError
+	)
+	switch {
+	case errors.As(err, &statusErr):
+		return statusClass(statusErr.Code)
+	case errors.As(err, &headerErr), errors.As(err, &alertErr), errors.As(err, &verifyErr), errors.As(err, &unknownCA):
+		return ClassTLS
+	case errors.As(err, &syntaxErr), errors.Is(err, ErrNoProtocol):
+		return ClassProtocolMismatch
+	}
+
+	msg := err.Error()
+	for _, m := range errorMessages {
+		if strings.Contains(msg, m.text) {
+			return m.class
+		}
+	}
+	return ClassOther
+}
+
+func statusClass(code int) ErrorClass {
+	switch code {
+	case http.StatusProxyAuthRequired:
+		return ClassProxyAuth
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return ClassBadGateway
+	default:
+		return ClassJudge
+	}
+}
+
+var errorMessages = []struct {
+	text  string
+	class ErrorClass
+}{
+	// net/http reports a refused CONNECT with the status line as error text
+	{"Proxy Authentication Required", ClassProxyAuth},
+	{"Bad Gateway", ClassBadGateway},
+	{"Service Unavailable", ClassBadGateway},
+	{"Gateway Timeout", ClassBadGateway},
+	{"Internal Server Error", ClassBadGateway},
+	{"tls: ", ClassTLS},
+	{"x509: ", ClassTLS},
+	{"malformed HTTP", ClassProtocolMismatch},
+	{"server gave HTTP response", ClassProtocolMismatch},
+	// h12.io/socks
+	{"no IPv4 address found", ClassDNS},
+	{"socks method negotiation failed", ClassProxyAuth},
+	{"user/password login failed", ClassProxyAuth},
+	{"identd", ClassProxyAuth},
+	{"can't complete SOCKS5 connection", ClassBadGateway},
+	{"socks connection request", ClassBadGateway},
+	{"server does not respond properly", ClassProtocolMismatch},
+	{"server does not support", ClassProtocolMismatch},
+	{"invalid character", ClassProtocolMismatch},
+}
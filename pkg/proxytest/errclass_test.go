@@ -0,0 +1,48 @@
+package proxytest
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	var syntaxErr error = &json.SyntaxError{}
+	tests := []struct {
+		err  error
+		want ErrorClass
+	}{
+		{nil, ClassNone},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, ClassRefused},
+		{fmt.Errorf("dial: %w", syscall.EHOSTUNREACH), ClassRefused},
+		{&url.Error{Op: "Get", URL: "http://judge", Err: context.DeadlineExceeded}, ClassTimeout},
+		{os.ErrDeadlineExceeded, ClassTimeout},
+		{&net.DNSError{Err: "no such host", Name: "judge", IsNotFound: true}, ClassDNS},
+		{&StatusError{Code: 407}, ClassProxyAuth},
+		{fmt.Errorf("check: %w", &StatusError{Code: 502}), ClassBadGateway},
+		{&StatusError{Code: 504}, ClassBadGateway},
+		{&StatusError{Code: 500}, ClassJudge},
+		{&StatusError{Code: 429}, ClassJudge},
+		{tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}, ClassTLS},
+		{fmt.Errorf("decode: %w", syntaxErr), ClassProtocolMismatch},
+		{fmt.Errorf("probe: %w", ErrNoProtocol), ClassProtocolMismatch},
+		{errors.New("Proxy Authentication Required"), ClassProxyAuth},
+		{errors.New("Bad Gateway"), ClassBadGateway},
+		{errors.New("net/http: HTTP/1.x transport connection broken: malformed HTTP response"), ClassProtocolMismatch},
+		{errors.New("socks connection request failed: general SOCKS server failure"), ClassBadGateway},
+		{errors.New("socks method negotiation failed"), ClassProxyAuth},
+		{errors.New("something else"), ClassOther},
+	}
+	for _, tt := range tests {
+		if got := Classify(tt.err); got != tt.want {
+			t.Errorf("Classify(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
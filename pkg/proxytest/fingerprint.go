@@ -0,0 +1,208 @@
+package proxytest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ErrNoProtocol is returned by Check when the endpoint answered none of the
+// fingerprint probes like a proxy would.
+var ErrNoProtocol = errors.New("endpoint speaks no known proxy protocol")
+
+// ProtocolSet is a set of protocols, one bit per Protocol.
+type ProtocolSet uint8
+
+// AllProtocols contains every protocol the checker knows.
+const AllProtocols = ProtocolSet(1<<ProtoHTTP | 1<<ProtoHTTPS | 1<<ProtoSOCKS4 | 1<<ProtoSOCKS4A | 1<<ProtoSOCKS5)
+
+func (s ProtocolSet) Has(p Protocol) bool {
+	return s&(1<<p) != 0
+}
+
+func (s ProtocolSet) With(p ...Protocol) ProtocolSet {
+	for _, proto := range p {
+		s |= 1 << proto
+	}
+	return s
+}
+
+func (s ProtocolSet) String() string {
+	var names []byte
+	for p := ProtoHTTP; p <= ProtoSOCKS5; p++ {
+		if !s.Has(p) {
+			continue
+		}
+		if len(names) > 0 {
+			names = append(names, ',')
+		}
+		names = append(names, p.String()...)
+	}
+	return string(names)
+}
+
+// probe is a minimal protocol greeting and the check of the first reply bytes.
+type probe struct {
+	protos []Protocol
+	// target is the URL the proxy forwards the request to, if any. The probe
+	// waits for Limits before it is sent.
+	target  string
+	request []byte
+	size    int
+	match   func(reply []byte) bool
+	// fallback is sent over a new connection when the reply did not match.
+	fallback *probe
+}
+
+func httpStatusLine(reply []byte) bool {
+	return bytes.Equal(reply, []byte("HTTP/"))
+}
+
+// socksProbes need no destination of ours: the SOCKS4 CONNECT goes to a
+// public address and the reply code alone tells the protocol.
+var socksProbes = []probe{
+	{
+		// version 5, one method, no authentication
+		protos:  []Protocol{ProtoSOCKS5},
+		request: []byte{0x05, 0x01, 0x00},
+		size:    2,
+		match:   func(reply []byte) bool { return reply[0] == 0x05 },
+	},
+	{
+		// version 4 CONNECT to 1.1.1.1:80 with an empty user id. Any reply
+		// code means the endpoint speaks SOCKS4, even if it refused us.
+		protos:  []Protocol{ProtoSOCKS4, ProtoSOCKS4A},
+		request: []byte{0x04, 0x01, 0x00, 0x50, 0x01, 0x01, 0x01, 0x01, 0x00},
+		size:    2,
+		match:   func(reply []byte) bool { return reply[0] == 0x00 && reply[1] >= 0x5a && reply[1] <= 0x5d },
+	},
+}
+
+// probes returns the fingerprint probes. The HTTP ones target the judge so
+// a proxy that forwards them only reaches hosts covered by Limits.
+func (pc *ProxyChecker) probes() []probe {
+	var connectHost, getHost string
+	if u, err := url.Parse(pc.HTTPBinIPURL); err == nil {
+		port := u.Port()
+		if port == "" {
+			port = "443"
+		}
+		connectHost = net.JoinHostPort(u.Hostname(), port)
+	}
+	if u, err := url.Parse(pc.HTTPBinGetURL); err == nil {
+		getHost = u.Host
+	}
+	return append(slices.Clone(socksProbes), probe{
+		// a proxy that refuses CONNECT still answers with an HTTP status line
+		protos:  []Protocol{ProtoHTTP, ProtoHTTPS},
+		target:  pc.HTTPBinIPURL,
+		request: fmt.Appendf(nil, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", connectHost, connectHost),
+		size:    5,
+		match:   httpStatusLine,
+		// some plain HTTP proxies drop CONNECT without an answer
+		fallback: &probe{
+			protos:  []Protocol{ProtoHTTP},
+			target:  pc.HTTPBinGetURL,
+			request: fmt.Appendf(nil, "GET %s HTTP/1.1\r\nHost: %s\r\n\r\n", pc.HTTPBinGetURL, getHost),
+			size:    5,
+			match:   httpStatusLine,
+		},
+	})
+}
+
+// Fingerprint sends every probe over its own connection to addr and returns
+// the protocols whose greeting got a matching reply. Each probe runs within
+// ProbeTimeout. When none matched, the error is ErrNoProtocol, wrapping the
+// connection error if no probe got a reply at all.
+func (pc *ProxyChecker) Fingerprint(ctx context.Context, addr string) (ProtocolSet, error) {
+	var (
+		mu      sync.Mutex
+		set     ProtocolSet
+		replied bool
+		connErr error
+		wg      sync.WaitGroup
+	)
+	for _, pr := range pc.probes() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			protos, err := pr.detect(ctx, pc.Limits, addr, pc.ProbeTimeout)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case len(protos) > 0:
+				set = set.With(protos...)
+			case err == nil:
+				replied = true
+			case connErr == nil:
+				connErr = err
+			}
+		}()
+	}
+	wg.Wait()
+
+	if set != 0 {
+		return set, nil
+	}
+	if replied || connErr == nil {
+		return 0, ErrNoProtocol
+	}
+	return 0, fmt.Errorf("%w: %w", ErrNoProtocol, connErr)
+}
+
+// detect returns the protocols of the first probe in the fallback chain
+// whose reply matched. The error is set when no probe got a reply.
+func (pr *probe) detect(ctx context.Context, limits *HostLimits, addr string, timeout time.Duration) ([]Protocol, error) {
+	ok, err := pr.run(ctx, limits, addr, timeout)
+	if ok {
+		return pr.protos, nil
+	}
+	var opErr *net.OpError
+	if pr.fallback == nil || ctx.Err() != nil || errors.As(err, &opErr) && opErr.Op == "dial" {
+		return nil, err
+	}
+	protos, fallbackErr := pr.fallback.detect(ctx, limits, addr, timeout)
+	if err == nil {
+		// the first probe got a reply, just not a matching one
+		return protos, nil
+	}
+	return protos, fallbackErr
+}
+
+// run reports whether the reply matched. The error is set when there was
+// no reply to match.
+func (pr *probe) run(ctx context.Context, limits *HostLimits, addr string, timeout time.Duration) (bool, error) {
+	if pr.target != "" {
+		if err := limits.Wait(ctx, pr.target); err != nil {
+			return false, err
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	deadline, _ := ctx.Deadline()
+	_ = conn.SetDeadline(deadline)
+
+	if _, err := conn.Write(pr.request); err != nil {
+		return false, err
+	}
+	reply := make([]byte, pr.size)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return false, err
+	}
+	return pr.match(reply), nil
+}
@@ -0,0 +1,112 @@
+package proxytest
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveHTTPProxy answers plain GETs and, when connect is set, CONNECTs. A
+// refused CONNECT closes the connection without an answer.
+func serveHTTPProxy(t *testing.T, connect bool) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				line, _ := bufio.NewReader(conn).ReadString('\n')
+				if strings.HasPrefix(line, "GET ") || connect {
+					_, _ = conn.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"))
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestFingerprintHTTP(t *testing.T) {
+	ctx := context.Background()
+
+	pc := NewProxyChecker("", 1)
+	pc.ProbeTimeout = 300 * time.Millisecond
+
+	set, err := pc.Fingerprint(ctx, serveHTTPProxy(t, true))
+	if err != nil || set != ProtocolSet(0).With(ProtoHTTP, ProtoHTTPS) {
+		t.Errorf("CONNECT proxy: %s, %v, want http,https", set, err)
+	}
+
+	set, err = pc.Fingerprint(ctx, serveHTTPProxy(t, false))
+	if err != nil || set != ProtocolSet(0).With(ProtoHTTP) {
+		t.Errorf("GET only proxy: %s, %v, want http", set, err)
+	}
+}
+
+func TestFingerprintRefused(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+
+	_, err = NewProxyChecker("", 1).Fingerprint(context.Background(), addr)
+	if !errors.Is(err, ErrNoProtocol) || Classify(err) != ClassRefused {
+		t.Errorf("closed port: %v (%s), want ErrNoProtocol classified as refused", err, Classify(err))
+	}
+}
+
+func TestFingerprintTargets(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	lines := make(chan string, 4)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				line, _ := bufio.NewReader(conn).ReadString('\n')
+				if strings.HasPrefix(line, "CONNECT ") || strings.HasPrefix(line, "GET ") {
+					lines <- strings.TrimSpace(line)
+				}
+			}()
+		}
+	}()
+
+	pc := NewProxyChecker("", 1)
+	pc.HTTPBinIPURL = "https://judge.test:8443/ip"
+	pc.HTTPBinGetURL = "http://judge.test/get"
+	pc.ProbeTimeout = 300 * time.Millisecond
+	_, _ = pc.Fingerprint(context.Background(), ln.Addr().String())
+
+	want := []string{"CONNECT judge.test:8443 HTTP/1.1", "GET http://judge.test/get HTTP/1.1"}
+	// Fingerprint returns only after every probe got its reply or timed out
+	for _, w := range want {
+		select {
+		case got := <-lines:
+			if got != w {
+				t.Errorf("probe %q, want %q", got, w)
+			}
+		default:
+			t.Errorf("no probe, want %q", w)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package proxytest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/yuridevx/proxylist/pkg/netlist"
+)
+
+// Reasons a proxy is flagged as a honeypot or otherwise untrustworthy.
+const (
+	FlagBlocklisted   = "blocklisted"
+	FlagStatic        = "static response"
+	FlagCaptivePortal = "captive portal"
+	FlagAnswersAll    = "answers unresolvable hosts"
+	FlagTooFast       = "faster than possible"
+)
+
+// HoneypotTest flags proxies that work but cannot be trusted. Blocklist
+// may be nil.
+type HoneypotTest struct {
+	Blocklist *netlist.List
+}
+
+// Flag is the verdict of the honeypot test, Reason is empty when clean.
+// Checked is false when the test did not run.
+type Flag struct {
+	Checked bool
+	Flagged bool
+	Reason  string
+}
+
+func flagged(reason string) Flag {
+	return Flag{Checked: true, Flagged: true, Reason: reason}
+}
+
+// classify runs the honeypot heuristics against a working proxy, cheapest first.
+func (pc *ProxyChecker) classify(ctx context.Context, best BestResult, proxyAddr string) Flag {
+	host, _, _ := net.SplitHostPort(proxyAddr)
+	if entry, ok := pc.Honeypot.Blocklist.Match(host); ok {
+		return flagged(FlagBlocklisted + " " + entry)
+	}
+
+	// a proxied request needs at least one round trip to the proxy and
+	// one from the proxy on, so a first byte well before the bare connect
+	// to the proxy could finish means the answer never left the proxy.
+	// Medians of separate samples can mislead, so it must hold in each.
+	if best.Latency.TooFast {
+		return flagged(FlagTooFast)
+	}
+
+	client := pc.proxyClient(best.Proto, proxyAddr)
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+
+	nonce := newNonce()
+	if reason := pc.checkEcho(ctx, client, nonce); reason != "" {
+		return flagged(reason)
+	}
+
+	// .invalid never resolves (RFC 2606), an honest proxy cannot serve it
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+nonce+".invalid/", nil)
+	if resp, err := client.Do(req); err == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		if resp.StatusCode < 300 {
+			return flagged(FlagAnswersAll)
+		}
+	}
+	return Flag{Checked: true}
+}
+
+// checkEcho asks the judge to echo a nonce. A portal redirects or serves a
+// page, a canned responder returns the same body without the nonce.
+func (pc *ProxyChecker) checkEcho(ctx context.Context, client *http.Client, nonce string) string {
+	target, err := url.Parse(pc.HTTPBinGetURL)
+	if err != nil {
+		return ""
+	}
+	q := target.Query()
+	q.Set("proxylist", nonce)
+	target.RawQuery = q.Encode()
+
+	if err := pc.Limits.Wait(ctx, target.String()); err != nil {
+		return ""
+	}
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		if loc, err := resp.Location(); err == nil && loc.Hostname() != target.Hostname() {
+			return FlagCaptivePortal
+		}
+		return ""
+	}
+	if resp.StatusCode != http.StatusOK {
+		return ""
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return ""
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "text/html" || strings.Contains(strings.ToLower(string(body)), "<form") {
+		return FlagCaptivePortal
+	}
+	if !strings.Contains(string(body), nonce) {
+		return FlagStatic
+	}
+	return ""
+}
+
+func newNonce() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
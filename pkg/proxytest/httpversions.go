@@ -0,0 +1,124 @@
+package proxytest
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// HTTPVersionsTest checks whether HTTP/2 works end to end through the proxy
+// tunnel, and HTTP/3 through the UDP relay of SOCKS5 proxies. Either URL may
+// be empty to skip that version.
+type HTTPVersionsTest struct {
+	HTTP2URL string
+	HTTP3URL string
+}
+
+// HTTPVersions reports the HTTP versions that worked through a proxy.
+// HTTP3Tested is false for proxies without a UDP relay.
+type HTTPVersions struct {
+	HTTP2       bool
+	HTTP2Tested bool
+	HTTP3       bool
+	HTTP3Tested bool
+}
+
+func (pc *ProxyChecker) measureHTTPVersions(ctx context.Context, proto Protocol, proxyAddr string) HTTPVersions {
+	var v HTTPVersions
+	if pc.HTTPVersions.HTTP2URL != "" && pc.Limits.Wait(ctx, pc.HTTPVersions.HTTP2URL) == nil {
+		v.HTTP2Tested = true
+		v.HTTP2 = pc.checkHTTP2(ctx, proto, proxyAddr)
+	}
+	if proto == ProtoSOCKS5 && pc.HTTPVersions.HTTP3URL != "" && pc.Limits.Wait(ctx, pc.HTTPVersions.HTTP3URL) == nil {
+		v.HTTP3Tested = true
+		v.HTTP3 = pc.checkHTTP3(ctx, proxyAddr)
+	}
+	return v
+}
+
+// checkHTTP2 negotiates ALPN h2 with the target over a proxy tunnel and
+// requires the response to come back over HTTP/2.
+func (pc *ProxyChecker) checkHTTP2(ctx context.Context, proto Protocol, proxyAddr string) bool {
+	tr := &http.Transport{
+		ForceAttemptHTTP2: true,
+		DisableKeepAlives: true,
+		DialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := pc.tunnel(ctx, proto, proxyAddr, addr)
+			if err != nil {
+				return nil, err
+			}
+			host, _, _ := net.SplitHostPort(addr)
+			tlsConn := tls.Client(conn, &tls.Config{
+				ServerName:         host,
+				NextProtos:         []string{"h2", "http/1.1"},
+				InsecureSkipVerify: true,
+			})
+			if err := tlsConn.HandshakeContext(ctx); err != nil {
+				_ = conn.Close()
+				return nil, err
+			}
+			return tlsConn, nil
+		},
+	}
+	defer tr.CloseIdleConnections()
+
+	ctx, cancel := context.WithTimeout(ctx, pc.Timeout)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, pc.HTTPVersions.HTTP2URL, nil)
+	resp, err := tr.RoundTrip(req)
+	if err != nil {
+		return false
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	return resp.ProtoMajor == 2
+}
+
+// checkHTTP3 runs QUIC through the SOCKS5 UDP relay. The target is resolved
+// locally since QUIC needs a UDP address to send to.
+func (pc *ProxyChecker) checkHTTP3(ctx context.Context, proxyAddr string) bool {
+	ctx, cancel := context.WithTimeout(ctx, pc.Timeout)
+	defer cancel()
+
+	target, err := url.Parse(pc.HTTPVersions.HTTP3URL)
+	if err != nil {
+		return false
+	}
+	port := target.Port()
+	if port == "" {
+		port = "443"
+	}
+	remote, err := net.ResolveUDPAddr("udp", net.JoinHostPort(target.Hostname(), port))
+	if err != nil {
+		return false
+	}
+
+	relay, err := dialSOCKS5UDP(ctx, proxyAddr)
+	if err != nil {
+		return false
+	}
+	defer relay.Close()
+
+	tr := &http3.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		Dial: func(ctx context.Context, _ string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
+			return quic.DialEarly(ctx, relay, remote, tlsCfg, cfg)
+		},
+	}
+	defer tr.Close()
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, pc.HTTPVersions.HTTP3URL, nil)
+	resp, err := tr.RoundTrip(req)
+	if err != nil {
+		return false
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	return resp.ProtoMajor == 3
+}
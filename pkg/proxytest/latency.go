@@ -0,0 +1,148 @@
+package proxytest
+
+import (
+	"context"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"slices"
+	"time"
+)
+
+// Latency summarises several timed requests through a proxy. The phase
+// durations are medians over the successful samples:
+//   - Connect is the TCP connect to the proxy itself
+//   - Handshake is the proxy negotiation on top of it (SOCKS greeting or
+//     CONNECT plus TLS), zero for plain HTTP proxies
+//   - TTFB is from the ready connection to the first response byte
+//
+// P50, P90 and Jitter (standard deviation) are over the total request time.
+// TooFast is set when in every sample the first byte came before half of
+// that sample's connect time.
+type Latency struct {
+	Samples   int
+	Connect   time.Duration
+	Handshake time.Duration
+	TTFB      time.Duration
+	P50       time.Duration
+	P90       time.Duration
+	Jitter    time.Duration
+	TooFast   bool
+}
+
+type latencySample struct {
+	connect   time.Duration
+	handshake time.Duration
+	ttfb      time.Duration
+	total     time.Duration
+}
+
+// measureLatency sends n requests through the proxy on fresh connections.
+// Failed samples are skipped; Latency.Samples is the number that succeeded.
+func (pc *ProxyChecker) measureLatency(ctx context.Context, proto Protocol, proxyAddr string, n int) Latency {
+	var samples []latencySample
+	for range n {
+		if s, err := pc.sampleLatency(ctx, proto, proxyAddr); err == nil {
+			samples = append(samples, s)
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return summarize(samples)
+}
+
+func (pc *ProxyChecker) sampleLatency(ctx context.Context, proto Protocol, proxyAddr string) (latencySample, error) {
+	target := pc.HTTPBinGetURL
+	if proto == ProtoHTTPS {
+		target = pc.HTTPBinIPURL
+	}
+	if err := pc.Limits.Wait(ctx, target); err != nil {
+		return latencySample{}, err
+	}
+
+	// the proxy dial hides the TCP connect inside the SOCKS or CONNECT
+	// handshake, so time a bare connect to tell the two apart
+	start := time.Now()
+	conn, err := (&net.Dialer{Timeout: pc.Timeout}).DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return latencySample{}, err
+	}
+	connect := time.Since(start)
+	_ = conn.Close()
+
+	client := pc.proxyClient(proto, proxyAddr)
+
+	var gotConn, firstByte time.Time
+	trace := &httptrace.ClientTrace{
+		GotConn:              func(httptrace.GotConnInfo) { gotConn = time.Now() },
+		GotFirstResponseByte: func() { firstByte = time.Now() },
+	}
+	req, _ := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), http.MethodGet, target, nil)
+
+	start = time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return latencySample{}, err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	total := time.Since(start)
+
+	s := latencySample{connect: connect, total: total}
+	if !gotConn.IsZero() {
+		s.handshake = max(gotConn.Sub(start)-connect, 0)
+		if !firstByte.IsZero() {
+			s.ttfb = firstByte.Sub(gotConn)
+		}
+	}
+	return s, nil
+}
+
+func summarize(samples []latencySample) Latency {
+	l := Latency{Samples: len(samples)}
+	if len(samples) == 0 {
+		return l
+	}
+
+	median := func(pick func(latencySample) time.Duration) time.Duration {
+		values := make([]time.Duration, len(samples))
+		for i, s := range samples {
+			values[i] = pick(s)
+		}
+		return percentile(values, 50)
+	}
+	l.Connect = median(func(s latencySample) time.Duration { return s.connect })
+	l.Handshake = median(func(s latencySample) time.Duration { return s.handshake })
+	l.TTFB = median(func(s latencySample) time.Duration { return s.ttfb })
+
+	// a sample without a traced first byte proves nothing either way
+	l.TooFast = !slices.ContainsFunc(samples, func(s latencySample) bool {
+		return s.ttfb <= 0 || s.ttfb >= s.connect/2
+	})
+
+	totals := make([]time.Duration, len(samples))
+	var mean float64
+	for i, s := range samples {
+		totals[i] = s.total
+		mean += float64(s.total)
+	}
+	mean /= float64(len(samples))
+	var variance float64
+	for _, t := range totals {
+		variance += (float64(t) - mean) * (float64(t) - mean)
+	}
+	l.Jitter = time.Duration(math.Sqrt(variance / float64(len(samples))))
+	l.P50 = percentile(totals, 50)
+	l.P90 = percentile(totals, 90)
+	return l
+}
+
+// percentile returns the nearest-rank percentile p of values, sorting them in place.
+func percentile(values []time.Duration, p int) time.Duration {
+	slices.Sort(values)
+	rank := (p*len(values) + 99) / 100
+	return values[max(rank, 1)-1]
+}
@@ -0,0 +1,80 @@
+package proxytest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	ms := func(values ...int) []time.Duration {
+		list := make([]time.Duration, len(values))
+		for i, v := range values {
+			list[i] = time.Duration(v) * time.Millisecond
+		}
+		return list
+	}
+	tests := []struct {
+		values []time.Duration
+		p      int
+		want   time.Duration
+	}{
+		{ms(7), 50, 7 * time.Millisecond},
+		{ms(7), 90, 7 * time.Millisecond},
+		{ms(30, 10, 20), 50, 20 * time.Millisecond},
+		{ms(30, 10, 20), 90, 30 * time.Millisecond},
+		{ms(40, 10, 30, 20), 50, 20 * time.Millisecond},
+		{ms(1, 2, 3, 4, 5, 6, 7, 8, 9, 10), 90, 9 * time.Millisecond},
+		{ms(1, 2, 3, 4, 5, 6, 7, 8, 9, 10), 0, 1 * time.Millisecond},
+		{ms(1, 2, 3, 4, 5, 6, 7, 8, 9, 10), 100, 10 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := percentile(tt.values, tt.p); got != tt.want {
+			t.Errorf("percentile(%v, %d) = %v, want %v", tt.values, tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	if l := summarize(nil); l != (Latency{}) {
+		t.Errorf("summarize(nil) = %+v, want zero", l)
+	}
+
+	l := summarize([]latencySample{
+		{connect: 10 * time.Millisecond, handshake: 20 * time.Millisecond, ttfb: 30 * time.Millisecond, total: 100 * time.Millisecond},
+		{connect: 30 * time.Millisecond, handshake: 40 * time.Millisecond, ttfb: 50 * time.Millisecond, total: 300 * time.Millisecond},
+		{connect: 20 * time.Millisecond, handshake: 30 * time.Millisecond, ttfb: 40 * time.Millisecond, total: 200 * time.Millisecond},
+	})
+	want := Latency{
+		Samples:   3,
+		Connect:   20 * time.Millisecond,
+		Handshake: 30 * time.Millisecond,
+		TTFB:      40 * time.Millisecond,
+		P50:       200 * time.Millisecond,
+		P90:       300 * time.Millisecond,
+		// population standard deviation of 100, 200 and 300
+		Jitter: 81649658 * time.Nanosecond,
+	}
+	if l != want {
+		t.Errorf("summarize = %+v, want %+v", l, want)
+	}
+}
+
+func TestSummarizeTooFast(t *testing.T) {
+	fast := latencySample{connect: 40 * time.Millisecond, ttfb: 5 * time.Millisecond, total: 50 * time.Millisecond}
+	tests := []struct {
+		name    string
+		samples []latencySample
+		want    bool
+	}{
+		{"every sample", []latencySample{fast, fast, fast}, true},
+		// the median TTFB is under half the median connect, yet one
+		// sample had an honest first byte
+		{"one honest sample", []latencySample{fast, fast, {connect: 10 * time.Millisecond, ttfb: 30 * time.Millisecond}}, false},
+		{"untraced first byte", []latencySample{fast, {connect: 40 * time.Millisecond}}, false},
+	}
+	for _, tt := range tests {
+		if got := summarize(tt.samples).TooFast; got != tt.want {
+			t.Errorf("%s: TooFast %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
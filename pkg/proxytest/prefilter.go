@@ -0,0 +1,123 @@
+package proxytest
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yuridevx/proxylist/domain"
+	"github.com/yuridevx/proxylist/pkg/dedup"
+	"github.com/yuridevx/proxylist/pkg/models"
+	"github.com/yuridevx/proxylist/pkg/stats"
+	"go.uber.org/zap"
+)
+
+// PreFilter sits in front of the ProxySink and drops proxies whose port
+// does not accept a TCP connection, so the expensive protocol checks only
+// run against endpoints that are alive. It runs many more workers than the
+// sink since a connect attempt is cheap.
+type PreFilter struct {
+	in      <-chan domain.ProvidedProxy
+	out     chan domain.ProvidedProxy
+	log     *zap.Logger
+	repo    *models.Queries
+	de      *dedup.Deduplicator
+	stats   *stats.Collector
+	workers int
+	timeout time.Duration
+	wg      sync.WaitGroup
+}
+
+// NewPreFilter wires up a pre-filter with 'n' concurrent connect workers.
+// Dropped proxies are counted as failed checks in collector, which may be
+// nil, and their connect error is stored in db.
+func NewPreFilter(in <-chan domain.ProvidedProxy, log *zap.Logger, db *pgxpool.Pool, de *dedup.Deduplicator, collector *stats.Collector, n int, timeout time.Duration) *PreFilter {
+	return &PreFilter{
+		in:      in,
+		out:     make(chan domain.ProvidedProxy),
+		log:     log,
+		repo:    models.New(db),
+		de:      de,
+		stats:   collector,
+		workers: max(n, 1),
+		timeout: timeout,
+	}
+}
+
+// Out is the channel of reachable proxies to hand to the ProxySink.
+func (f *PreFilter) Out() <-chan domain.ProvidedProxy {
+	return f.out
+}
+
+// Start spins up the connect workers.
+func (f *PreFilter) Start(ctx context.Context) {
+	for i := 0; i < f.workers; i++ {
+		f.wg.Add(1)
+		go f.worker(ctx)
+	}
+}
+
+// Stop blocks until all workers have exited.
+func (f *PreFilter) Stop() {
+	f.wg.Wait()
+}
+
+func (f *PreFilter) worker(ctx context.Context) {
+	defer f.wg.Done()
+	var dialer net.Dialer
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case proxy, ok := <-f.in:
+			if !ok {
+				return
+			}
+			if !proxy.Retest && !f.de.ShouldProcess(proxy, recheckAge) {
+				continue
+			}
+			if err := f.reachable(ctx, &dialer, proxy); err != nil {
+				f.drop(ctx, proxy, err)
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case f.out <- proxy:
+			}
+		}
+	}
+}
+
+func (f *PreFilter) reachable(ctx context.Context, dialer *net.Dialer, proxy domain.ProvidedProxy) error {
+	dialCtx, cancel := context.WithTimeout(ctx, f.timeout)
+	defer cancel()
+
+	conn, err := dialer.DialContext(dialCtx, "tcp", net.JoinHostPort(proxy.IP, strconv.Itoa(proxy.Port)))
+	if err != nil {
+		return err
+	}
+	_ = conn.Close()
+	return nil
+}
+
+// drop accounts a dead proxy the same way the sink accounts a failed check.
+func (f *PreFilter) drop(ctx context.Context, proxy domain.ProvidedProxy, err error) {
+	if ctx.Err() != nil {
+		return
+	}
+	if !f.de.Seen(proxy) {
+		f.stats.RecordNew(proxy.Provider)
+	}
+	f.stats.RecordCheck(proxy.Provider, false)
+	class := Classify(err)
+	f.stats.RecordFailure(EndpointProtocol, class.String())
+	storeCheckError(ctx, f.repo, f.log, proxy, EndpointProtocol, class, err)
+	_ = f.de.MarkGood(proxy, false)
+	_ = f.de.MarkProcessed(proxy)
+	f.log.Debug("proxy unreachable", zap.String("proxy", proxy.String()), zap.Error(err))
+}
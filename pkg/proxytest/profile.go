@@ -0,0 +1,65 @@
+package proxytest
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrFetchRequired fails a protocol whose check passed when the profile
+// requires the fetch check and it did not pass.
+var ErrFetchRequired = errors.New("fetch check required but failed")
+
+// Profile narrows what Check runs for a proxy. The zero Profile runs the
+// full pipeline with the checker's settings.
+type Profile struct {
+	Name string
+	// Protocols limits the protocols tested, empty tests all of them.
+	Protocols ProtocolSet
+	// Timeout replaces the checker timeout when set.
+	Timeout       time.Duration
+	SkipWebSocket bool
+	SkipFetch     bool
+	// FetchURL replaces the checker fetch URL when set.
+	FetchURL string
+	// RequireFetch counts a protocol as working only if the fetch passed.
+	RequireFetch bool
+	// SkipExtras skips the latency samples and every optional measurement
+	// and classification after the protocol checks.
+	SkipExtras bool
+}
+
+// ParseProtocol returns the protocol named like Protocol.String.
+func ParseProtocol(name string) (Protocol, error) {
+	for p := ProtoHTTP; p <= ProtoSOCKS5; p++ {
+		if p.String() == name {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown protocol %q", name)
+}
+
+// withProfile returns a copy of the checker set up for prof.
+func (pc *ProxyChecker) withProfile(prof Profile) *ProxyChecker {
+	c := *pc
+	c.profile = prof
+	if prof.Timeout > 0 {
+		c.Timeout = prof.Timeout
+		if c.ProbeTimeout > 0 {
+			c.ProbeTimeout = min(c.ProbeTimeout, prof.Timeout)
+		}
+	}
+	if prof.FetchURL != "" {
+		c.FetchURL = prof.FetchURL
+	}
+	if prof.SkipExtras {
+		c.LatencySamples = 0
+		c.Bandwidth = nil
+		c.WSStability = nil
+		c.ConnectPorts = nil
+		c.HTTPVersions = nil
+		c.DNSJudge = nil
+		c.Honeypot = nil
+	}
+	return &c
+}
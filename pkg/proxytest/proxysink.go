@@ -1,18 +1,26 @@
 package proxytest
 
 import (
+	"cmp"
 	"context"
 	"github.com/yuridevx/proxylist/pkg/dedup"
+	"github.com/yuridevx/proxylist/pkg/judge"
 	"sync"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/yuridevx/proxylist/domain"
+	"github.com/yuridevx/proxylist/pkg/config"
 	"github.com/yuridevx/proxylist/pkg/models"
+	"github.com/yuridevx/proxylist/pkg/stats"
 	"go.uber.org/zap"
 )
 
+// recheckAge is how long a processed proxy is skipped unless retested.
+const recheckAge = 8 * time.Hour
+
 // ProxySink reads proxies from the 'in' channel and
 // dispatches them to a fixed pool of workers.
 type ProxySink struct {
@@ -24,11 +32,120 @@ type ProxySink struct {
 	wg       sync.WaitGroup
 	timeoutS int
 	de       *dedup.Deduplicator
+	stats    *stats.Collector
+	limit    *concurrency
+	limits   *HostLimits
+	samples  int
+	transfer *BandwidthTest
+	session  *WSStabilityTest
+	ports    *ConnectPortsTest
+	versions *HTTPVersionsTest
+	dns      DNSJudge
+	honeypot *HoneypotTest
+	judges   *judge.Watchdog
+	profiles map[string]Profile
+	recheck  string
+}
+
+// SinkOption configures optional ProxySink behaviour.
+type SinkOption func(*ProxySink)
+
+// WithStats records new entries and check outcomes per provider.
+func WithStats(c *stats.Collector) SinkOption {
+	return func(s *ProxySink) {
+		s.stats = c
+	}
+}
+
+// WithAdaptiveConcurrency starts conf.Max workers and lets only as many of
+// them pick up proxies as the local resources allow, starting from the
+// configured worker count.
+func WithAdaptiveConcurrency(conf config.ConcurrencyConfig) SinkOption {
+	return func(s *ProxySink) {
+		s.limit = newConcurrency(conf, s.log, s.workers)
+		s.workers = conf.Max
+	}
+}
+
+// WithRateLimits throttles the check requests of all workers per destination host.
+func WithRateLimits(limits *HostLimits) SinkOption {
+	return func(s *ProxySink) {
+		s.limits = limits
+	}
+}
+
+// WithLatencySamples times n extra requests through every working proxy.
+func WithLatencySamples(n int) SinkOption {
+	return func(s *ProxySink) {
+		s.samples = n
+	}
+}
+
+// WithBandwidth runs the bandwidth test against every working proxy.
+func WithBandwidth(test *BandwidthTest) SinkOption {
+	return func(s *ProxySink) {
+		s.transfer = test
+	}
+}
+
+// WithWSStability holds a websocket session open through every proxy with
+// working websockets.
+func WithWSStability(test *WSStabilityTest) SinkOption {
+	return func(s *ProxySink) {
+		s.session = test
+	}
+}
+
+// WithConnectPorts records which tunnel ports every working proxy accepts.
+func WithConnectPorts(test *ConnectPortsTest) SinkOption {
+	return func(s *ProxySink) {
+		s.ports = test
+	}
+}
+
+// WithHTTPVersions records whether HTTP/2 and HTTP/3 work through every working proxy.
+func WithHTTPVersions(test *HTTPVersionsTest) SinkOption {
+	return func(s *ProxySink) {
+		s.versions = test
+	}
+}
+
+// WithDNSJudge records remote DNS support and DNS leaks of every working proxy.
+func WithDNSJudge(judge DNSJudge) SinkOption {
+	return func(s *ProxySink) {
+		s.dns = judge
+	}
+}
+
+// WithHoneypot flags working proxies that look like honeypots or sit in a
+// blocklisted network so they are left out of selection.
+func WithHoneypot(test *HoneypotTest) SinkOption {
+	return func(s *ProxySink) {
+		s.honeypot = test
+	}
+}
+
+// WithJudges checks against the judges the watchdog hands out, pauses while
+// a judge role is down and discards failed checks that overlapped a judge failure.
+func WithJudges(w *judge.Watchdog) SinkOption {
+	return func(s *ProxySink) {
+		s.judges = w
+	}
+}
+
+// WithProfiles checks every proxy with the profile it names. Proxies that
+// were checked before use the revalidate profile instead, unless they were
+// queued for a retest with an explicit profile.
+func WithProfiles(profiles map[string]Profile, revalidate string) SinkOption {
+	return func(s *ProxySink) {
+		s.profiles = profiles
+		s.recheck = revalidate
+	}
 }
 
 // NewProxySink wires up a sink with 'n' concurrent workers.
-func NewProxySink(in <-chan domain.ProvidedProxy, log *zap.Logger, db *pgxpool.Pool, de *dedup.Deduplicator, fetchUrl string, n int, timeoutS int) *ProxySink {
-	return &ProxySink{
+func NewProxySink(in <-chan domain.ProvidedProxy, log *zap.Logger, db *pgxpool.Pool, de *dedup.Deduplicator, fetchUrl string, n int, timeoutS int, options ...SinkOption) *ProxySink {
+	s := &ProxySink{
 		in:       in,
 		log:      log,
 		db:       db,
@@ -37,10 +154,17 @@ func NewProxySink(in <-chan domain.ProvidedProxy, log *zap.Logger, db *pgxpool.P
 		timeoutS: timeoutS,
 		workers:  n,
 	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
 }
 
 // Start spins up the worker goroutines. Call Stop() after closing 'in'.
 func (s *ProxySink) Start(ctx context.Context) {
+	if s.limit != nil {
+		go s.limit.run(ctx)
+	}
 	for i := 0; i < s.workers; i++ {
 		s.wg.Add(1)
 		go s.worker(ctx, i)
@@ -56,9 +180,21 @@ func (s *ProxySink) Stop() {
 func (s *ProxySink) worker(ctx context.Context, id int) {
 	defer s.wg.Done()
 	checker := NewProxyChecker(s.fetchUrl, s.timeoutS)
+	checker.Limits = s.limits
+	checker.LatencySamples = s.samples
+	checker.Bandwidth = s.transfer
+	checker.WSStability = s.session
+	checker.ConnectPorts = s.ports
+	checker.HTTPVersions = s.versions
+	checker.DNSJudge = s.dns
+	checker.Honeypot = s.honeypot
 	repo := models.New(s.db)
 
 	for {
+		if s.limit != nil && !s.limit.wait(ctx, id) {
+			s.log.Info("worker shutting down", zap.Int("id", id))
+			return
+		}
 		select {
 		case <-ctx.Done():
 			s.log.Info("worker shutting down", zap.Int("id", id))
@@ -68,7 +204,13 @@ func (s *ProxySink) worker(ctx context.Context, id int) {
 				s.log.Info("input channel closed", zap.Int("worker", id))
 				return
 			}
+			if s.limit != nil {
+				s.limit.busy.Add(1)
+			}
 			s.processOne(ctx, checker, repo, id, proxy)
+			if s.limit != nil {
+				s.limit.busy.Add(-1)
+			}
 		}
 	}
 }
@@ -81,28 +223,66 @@ func (s *ProxySink) processOne(
 	workerID int,
 	proxy domain.ProvidedProxy,
 ) {
-	if !s.de.ShouldProcess(proxy, time.Hour*8) {
+	if !proxy.Retest && !s.de.ShouldProcess(proxy, recheckAge) {
 		return
 	}
 
+	var epoch uint64
+	if s.judges != nil {
+		endpoints, current, ok := s.judges.Wait(ctx)
+		if !ok {
+			return
+		}
+		epoch = current
+		checker.HTTPBinGetURL = cmp.Or(endpoints.GetURL, checker.HTTPBinGetURL)
+		checker.HTTPBinIPURL = cmp.Or(endpoints.IPURL, checker.HTTPBinIPURL)
+		checker.WebSocketURL = cmp.Or(endpoints.WebSocketURL, checker.WebSocketURL)
+		checker.FetchURL = cmp.Or(endpoints.FetchURL, checker.FetchURL)
+	}
+
 	defer func() {
-		_ = s.de.MarkProcessed(proxy)
+		s.log.Info("finished proxy", zap.String("proxy", proxy.String()))
 	}()
 
+	seen := s.de.Seen(proxy)
+	prof := s.profile(proxy, seen)
+	res, err := checker.CheckProfile(ctx, proxy, prof)
+	if ctx.Err() != nil {
+		return
+	}
+	passed := err == nil && res.Success
+	if !passed && s.judges != nil && !s.judges.Valid(epoch) {
+		// a judge failed meanwhile, so the proxy may be fine; leave it for the next round
+		s.log.Debug("check discarded, judge failed", zap.String("proxy", proxy.String()))
+		return
+	}
+
+	if !seen {
+		s.stats.RecordNew(proxy.Provider)
+	}
 	defer func() {
-		s.log.Info("finished proxy", zap.String("proxy", proxy.String()))
+		_ = s.de.MarkProcessed(proxy)
 	}()
 
-	res, err := checker.Check(ctx, proxy)
+	s.stats.RecordCheck(proxy.Provider, passed)
+	_ = s.de.MarkGood(proxy, passed)
+	if s.limit != nil {
+		s.limit.record(cmp.Or(err, res.Error))
+	}
+	for _, f := range res.Failures {
+		s.recordFailure(ctx, repo, workerID, proxy, f.Proto.String(), f.Class, f.Err)
+	}
 	if err != nil {
-		//s.log.Warn("check failed",
-		//	zap.Int("worker", workerID),
-		//	zap.String("proxy", proxy.String()),
-		//	zap.Error(err),
-		//)
+		s.recordFailure(ctx, repo, workerID, proxy, EndpointProtocol, Classify(err), err)
 		return
 	}
+	clearCheckError(ctx, repo, s.log, proxy, EndpointProtocol)
 
+	for p := ProtoHTTP; p <= ProtoSOCKS5; p++ {
+		if res.Passed.Has(p) {
+			clearCheckError(ctx, repo, s.log, proxy, p.String())
+		}
+	}
 	if !res.Success {
 		return
 	}
@@ -116,16 +296,59 @@ func (s *ProxySink) processOne(
 			Valid:  true,
 		},
 		DelayMs: pgtype.Int4{
-			Int32: int32(res.Duration.Milliseconds()),
+			Int32: int32(cmp.Or(res.Latency.P50, res.Duration).Milliseconds()),
 			Valid: true,
 		},
+		ConnectMs:   latencyMs(res.Latency, res.Latency.Connect),
+		HandshakeMs: latencyMs(res.Latency, res.Latency.Handshake),
+		TtfbMs:      latencyMs(res.Latency, res.Latency.TTFB),
+		P50Ms:       latencyMs(res.Latency, res.Latency.P50),
+		P90Ms:       latencyMs(res.Latency, res.Latency.P90),
+		JitterMs:    latencyMs(res.Latency, res.Latency.Jitter),
+		DownloadKbytesS: pgtype.Int4{
+			Int32: int32(res.Throughput.DownloadKBps),
+			Valid: res.Throughput.DownloadKBps > 0,
+		},
+		UploadKbytesS: pgtype.Int4{
+			Int32: int32(res.Throughput.UploadKBps),
+			Valid: res.Throughput.UploadKBps > 0,
+		},
+		WsRttMs: pgtype.Int4{
+			Int32: int32(res.WSStability.RTT.Milliseconds()),
+			Valid: res.WSStability.Received > 0,
+		},
+		WsStability: pgtype.Float4{
+			Float32: float32(res.WSStability.Stability),
+			Valid:   res.WSStability.Sent > 0,
+		},
+		WsUptimeS: pgtype.Int4{
+			Int32: int32(res.WSStability.Uptime.Seconds()),
+			Valid: res.WSStability.Sent > 0,
+		},
+		ConnectPorts: connectPorts(res.ConnectPorts),
+		Http2: pgtype.Bool{
+			Bool:  res.HTTPVersions.HTTP2,
+			Valid: res.HTTPVersions.HTTP2Tested,
+		},
+		Http3: pgtype.Bool{
+			Bool:  res.HTTPVersions.HTTP3,
+			Valid: res.HTTPVersions.HTTP3Tested,
+		},
+		RemoteDns: pgtype.Bool{
+			Bool:  res.DNS.RemoteDNS,
+			Valid: res.DNS.Tested,
+		},
+		DnsLeak: pgtype.Bool{
+			Bool:  res.DNS.Leak,
+			Valid: res.DNS.Tested,
+		},
 		TestedAt: pgtype.Timestamp{
 			Time:  time.Now(),
 			Valid: true,
 		},
 		Websocket: pgtype.Bool{
-			Bool:  res.WebSocket.Success,
-			Valid: true,
+			Bool:  res.WebSocket != nil && res.WebSocket.Success,
+			Valid: res.WebSocket != nil,
 		},
 		Anonymity: pgtype.Bool{
 			Bool:  !res.ExposesIP,
@@ -133,12 +356,115 @@ func (s *ProxySink) processOne(
 		},
 		ItemFetch: pgtype.Bool{
 			Bool:  res.FetchSuccess,
-			Valid: true,
+			Valid: !prof.SkipFetch || prof.RequireFetch,
+		},
+		Profile: pgtype.Text{
+			String: prof.Name,
+			Valid:  prof.Name != "",
 		},
 	}
 
-	err = repo.InsertProxyInfoTestResults(ctx, params)
+	err = pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		q := repo.WithTx(tx)
+		if err := q.InsertProxyInfoTestResults(ctx, params); err != nil {
+			return err
+		}
+		if !res.Flag.Checked {
+			// a skipped honeypot test leaves the last verdict in place
+			return nil
+		}
+		return q.SetProxyInfoFlag(ctx, models.SetProxyInfoFlagParams{
+			Ip:       params.Ip,
+			Port:     params.Port,
+			Protocol: params.Protocol,
+			Flagged:  res.Flag.Flagged,
+			FlagReason: pgtype.Text{
+				String: res.Flag.Reason,
+				Valid:  res.Flag.Flagged,
+			},
+		})
+	})
 	if err != nil {
 		s.log.Error("failed to insert proxy info test results", zap.Any("proxy", proxy), zap.Error(err))
 	}
 }
+
+// profile picks the check profile of proxy. Unknown names fall back to the
+// full checks.
+func (s *ProxySink) profile(proxy domain.ProvidedProxy, seen bool) Profile {
+	name := proxy.Profile
+	if seen && s.recheck != "" && !(proxy.Retest && proxy.Profile != "") {
+		name = s.recheck
+	}
+	if name == "" {
+		return Profile{}
+	}
+	prof, ok := s.profiles[name]
+	if !ok {
+		s.log.Warn("unknown check profile", zap.String("profile", name), zap.String("proxy", proxy.String()))
+		return Profile{}
+	}
+	return prof
+}
+
+// recordFailure counts a classified failure and stores it as the last
+// error of the proxy over protocol.
+func (s *ProxySink) recordFailure(ctx context.Context, repo *models.Queries, workerID int, proxy domain.ProvidedProxy, protocol string, class ErrorClass, err error) {
+	s.stats.RecordFailure(protocol, class.String())
+	s.log.Debug("check failed",
+		zap.Int("worker", workerID),
+		zap.String("proxy", proxy.String()),
+		zap.String("protocol", protocol),
+		zap.Stringer("class", class),
+		zap.Error(err),
+	)
+
+	storeCheckError(ctx, repo, s.log, proxy, protocol, class, err)
+}
+
+// storeCheckError keeps err as the last error of the proxy over protocol.
+func storeCheckError(ctx context.Context, repo *models.Queries, log *zap.Logger, proxy domain.ProvidedProxy, protocol string, class ErrorClass, err error) {
+	dbErr := repo.UpsertProxyCheckError(ctx, models.UpsertProxyCheckErrorParams{
+		Ip:         proxy.IP,
+		Port:       int32(proxy.Port),
+		Protocol:   protocol,
+		Provider:   pgtype.Text{String: proxy.Provider, Valid: true},
+		ErrorClass: class.String(),
+		Error:      pgtype.Text{String: err.Error(), Valid: true},
+		TestedAt:   pgtype.Timestamp{Time: time.Now(), Valid: true},
+	})
+	if dbErr != nil {
+		log.Error("failed to store check error", zap.Any("proxy", proxy), zap.Error(dbErr))
+	}
+}
+
+// clearCheckError removes the last error of the proxy over protocol once
+// the proxy got past it.
+func clearCheckError(ctx context.Context, repo *models.Queries, log *zap.Logger, proxy domain.ProvidedProxy, protocol string) {
+	dbErr := repo.DeleteProxyCheckError(ctx, models.DeleteProxyCheckErrorParams{
+		Ip:       proxy.IP,
+		Port:     int32(proxy.Port),
+		Protocol: protocol,
+	})
+	if dbErr != nil {
+		log.Error("failed to clear check error", zap.Any("proxy", proxy), zap.Error(dbErr))
+	}
+}
+
+// latencyMs stores d in milliseconds, or NULL when no latency sample succeeded.
+func latencyMs(l Latency, d time.Duration) pgtype.Int4 {
+	return pgtype.Int4{Int32: int32(d.Milliseconds()), Valid: l.Samples > 0}
+}
+
+// connectPorts stores the accepted ports, an empty array when none were
+// accepted and NULL when the ports were not tested.
+func connectPorts(ports []int) []int32 {
+	if ports == nil {
+		return nil
+	}
+	list := make([]int32, len(ports))
+	for i, port := range ports {
+		list[i] = int32(port)
+	}
+	return list
+}
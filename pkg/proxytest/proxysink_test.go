@@ -0,0 +1,42 @@
+package proxytest
+
+import (
+	"testing"
+
+	"github.com/yuridevx/proxylist/domain"
+	"go.uber.org/zap"
+)
+
+func TestSinkProfile(t *testing.T) {
+	s := &ProxySink{log: zap.NewNop()}
+	WithProfiles(map[string]Profile{
+		"fast":  {Name: "fast"},
+		"quick": {Name: "quick"},
+	}, "quick")(s)
+
+	tests := []struct {
+		name  string
+		proxy domain.ProvidedProxy
+		seen  bool
+		want  string
+	}{
+		{"default checks", domain.ProvidedProxy{}, false, ""},
+		{"provider profile", domain.ProvidedProxy{Profile: "fast"}, false, "fast"},
+		{"seen proxy revalidates", domain.ProvidedProxy{Profile: "fast"}, true, "quick"},
+		{"seen without a provider profile", domain.ProvidedProxy{}, true, "quick"},
+		{"retest with a profile", domain.ProvidedProxy{Profile: "fast", Retest: true}, true, "fast"},
+		{"retest without a profile", domain.ProvidedProxy{Retest: true}, true, "quick"},
+		{"unknown profile", domain.ProvidedProxy{Profile: "missing"}, false, ""},
+	}
+	for _, tt := range tests {
+		if got := s.profile(tt.proxy, tt.seen); got.Name != tt.want {
+			t.Errorf("%s: profile %q, want %q", tt.name, got.Name, tt.want)
+		}
+	}
+
+	// without a revalidate profile seen proxies keep their own
+	WithProfiles(map[string]Profile{"fast": {Name: "fast"}}, "")(s)
+	if got := s.profile(domain.ProvidedProxy{Profile: "fast"}, true); got.Name != "fast" {
+		t.Errorf("no revalidate profile: profile %q, want fast", got.Name)
+	}
+}
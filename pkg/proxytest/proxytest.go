@@ -59,6 +59,21 @@ type ProtocolResult struct {
 type BestResult struct {
 	Proto Protocol
 	ProtocolResult
+	// Latency, Throughput and WSStability are measured over the chosen
+	// protocol, zero when not measured.
+	Latency     Latency
+	Throughput  Throughput
+	WSStability WSStability
+	// ConnectPorts are the tunnel ports the proxy accepted, nil when not tested.
+	ConnectPorts []int
+	HTTPVersions HTTPVersions
+	DNS          DNSResult
+	// Flag marks a working proxy that looks like a honeypot.
+	Flag Flag
+	// Passed holds every protocol whose check succeeded, not only Proto.
+	Passed ProtocolSet
+	// Failures are the classified errors of every protocol that failed.
+	Failures []Failure
 }
 
 // ProxyChecker knows how to test proxies.
@@ -68,6 +83,29 @@ type ProxyChecker struct {
 	HTTPBinIPURL  string
 	WebSocketURL  string
 	FetchURL      string
+	// ProbeTimeout bounds the protocol fingerprint run before the full
+	// checks. Zero runs every protocol check unconditionally.
+	ProbeTimeout time.Duration
+	// Limits throttles requests per destination host. Nil means unlimited.
+	Limits *HostLimits
+	// LatencySamples is the number of timed requests sent through a working
+	// proxy after the checks. Zero keeps the single check duration only.
+	LatencySamples int
+	// Bandwidth transfers a payload through a working proxy. Nil skips it.
+	Bandwidth *BandwidthTest
+	// WSStability holds a websocket session open through a proxy whose
+	// websocket check passed. Nil skips it.
+	WSStability *WSStabilityTest
+	// ConnectPorts tunnels through a working proxy to a set of ports. Nil skips it.
+	ConnectPorts *ConnectPortsTest
+	// HTTPVersions checks HTTP/2 and HTTP/3 through a working proxy. Nil skips it.
+	HTTPVersions *HTTPVersionsTest
+	// DNSJudge detects remote resolution and DNS leaks. Nil skips it.
+	DNSJudge DNSJudge
+	// Honeypot flags working proxies that behave suspiciously. Nil skips it.
+	Honeypot *HoneypotTest
+
+	profile Profile
 }
 
 // NewProxyChecker returns a checker with sensible defaults.
@@ -79,15 +117,67 @@ func NewProxyChecker(fetchURL string, timeoutS int) *ProxyChecker {
 		HTTPBinIPURL:  "https://httpbin.org/ip",
 		WebSocketURL:  "ws://echo.websocket.org",
 		FetchURL:      fetchURL,
+		ProbeTimeout:  min(time.Duration(timeoutS)*time.Second, 5*time.Second),
 	}
 }
 
-// Check tests HTTP, HTTPS, SOCKS4, SOCKS4A, and SOCKS5 in parallel,
+// Check tests HTTP, HTTPS, SOCKS4, SOCKS4A, and SOCKS5 in parallel, limited
+// to the protocols the endpoint answered when fingerprinted,
 // then returns only the BestResult according to:
 //  1. If any WebSocket tests succeeded, pick the one with the fastest WS.Duration
 //  2. Otherwise, pick highest-priority success: socks5 > socks4a > socks4 > https > http
+//
+// A working proxy then gets LatencySamples timed requests, the bandwidth,
+// websocket stability, tunnel port, HTTP version and DNS tests over the
+// chosen protocol, and is finally classified by the honeypot test.
 func (pc *ProxyChecker) Check(ctx context.Context, p domain.ProvidedProxy) (BestResult, error) {
+	return pc.CheckProfile(ctx, p, Profile{})
+}
+
+// CheckProfile is Check limited to what prof asks for.
+func (pc *ProxyChecker) CheckProfile(ctx context.Context, p domain.ProvidedProxy, prof Profile) (BestResult, error) {
+	pc = pc.withProfile(prof)
 	addr := fmt.Sprintf("%s:%d", p.IP, p.Port)
+	best, err := pc.checkAll(ctx, addr)
+	if err == nil && best.Success && pc.LatencySamples > 0 {
+		best.Latency = pc.measureLatency(ctx, best.Proto, addr, pc.LatencySamples)
+	}
+	if err == nil && best.Success && pc.Bandwidth != nil {
+		best.Throughput = pc.measureThroughput(ctx, best.Proto, addr)
+	}
+	if err == nil && best.WebSocket != nil && best.WebSocket.Success && pc.WSStability != nil {
+		best.WSStability = pc.measureWSStability(ctx, best.Proto, addr)
+	}
+	if err == nil && best.Success && pc.ConnectPorts != nil {
+		best.ConnectPorts = pc.measureConnectPorts(ctx, best.Proto, addr)
+	}
+	if err == nil && best.Success && pc.HTTPVersions != nil {
+		best.HTTPVersions = pc.measureHTTPVersions(ctx, best.Proto, addr)
+	}
+	if err == nil && best.Success && pc.DNSJudge != nil {
+		best.DNS = pc.measureDNS(ctx, best.Proto, addr)
+	}
+	if err == nil && best.Success && pc.Honeypot != nil {
+		best.Flag = pc.classify(ctx, best, addr)
+	}
+	return best, err
+}
+
+// checkAll runs the protocol checks and picks the best result.
+func (pc *ProxyChecker) checkAll(ctx context.Context, addr string) (BestResult, error) {
+	protos := AllProtocols
+	if pc.ProbeTimeout > 0 {
+		var err error
+		if protos, err = pc.Fingerprint(ctx, addr); err != nil {
+			return BestResult{}, err
+		}
+	}
+	if pc.profile.Protocols != 0 {
+		if protos &= pc.profile.Protocols; protos == 0 {
+			return BestResult{}, ErrNoProtocol
+		}
+	}
+
 	type item struct {
 		code Protocol
 		pr   ProtocolResult
@@ -96,49 +186,48 @@ func (pc *ProxyChecker) Check(ctx context.Context, p domain.ProvidedProxy) (Best
 	var wg sync.WaitGroup
 
 	// HTTP
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		ok, dur, exposes, err := pc.checkHTTP(ctx, addr)
-		pr := ProtocolResult{Success: ok, Duration: dur, Error: err, ExposesIP: exposes}
-		if ok {
-			// WebSocket over HTTP proxy
-			ws := pc.runWS(ctx, "http", addr)
-			pr.WebSocket = &ws
-			// custom URL GET
-			pr.FetchSuccess = pc.checkFetch(ctx, "http", addr)
-		}
-		resultsCh <- item{ProtoHTTP, pr}
-	}()
+	if protos.Has(ProtoHTTP) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, dur, exposes, err := pc.checkHTTP(ctx, addr)
+			pr := ProtocolResult{Success: ok, Duration: dur, Error: err, ExposesIP: exposes}
+			if ok {
+				pc.runExtras(ctx, "http", addr, &pr)
+			}
+			resultsCh <- item{ProtoHTTP, pr}
+		}()
+	}
 
 	// HTTPS
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		ok, dur, err := pc.checkHTTPS(ctx, addr)
-		pr := ProtocolResult{Success: ok, Duration: dur, Error: err}
-		if ok {
-			ws := pc.runWS(ctx, "https", addr)
-			pr.WebSocket = &ws
-			pr.FetchSuccess = pc.checkFetch(ctx, "https", addr)
-		}
-		resultsCh <- item{ProtoHTTPS, pr}
-	}()
+	if protos.Has(ProtoHTTPS) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, dur, err := pc.checkHTTPS(ctx, addr)
+			pr := ProtocolResult{Success: ok, Duration: dur, Error: err}
+			if ok {
+				pc.runExtras(ctx, "https", addr, &pr)
+			}
+			resultsCh <- item{ProtoHTTPS, pr}
+		}()
+	}
 
 	// SOCKS4, SOCKS4A, SOCKS5
 	for _, v := range []struct {
 		name string
 		code Protocol
 	}{{"socks4", ProtoSOCKS4}, {"socks4a", ProtoSOCKS4A}, {"socks5", ProtoSOCKS5}} {
+		if !protos.Has(v.code) {
+			continue
+		}
 		wg.Add(1)
 		go func(name string, code Protocol) {
 			defer wg.Done()
 			ok, dur, err := pc.checkSOCKS(ctx, addr, name)
 			pr := ProtocolResult{Success: ok, Duration: dur, Error: err}
 			if ok {
-				ws := pc.runWS(ctx, name, addr)
-				pr.WebSocket = &ws
-				pr.FetchSuccess = pc.checkFetch(ctx, name, addr)
+				pc.runExtras(ctx, name, addr, &pr)
 			}
 			resultsCh <- item{code, pr}
 		}(v.name, v.code)
@@ -148,9 +237,19 @@ func (pc *ProxyChecker) Check(ctx context.Context, p domain.ProvidedProxy) (Best
 	close(resultsCh)
 
 	// gather items
-	var items []item
+	var (
+		items    []item
+		passed   ProtocolSet
+		failures []Failure
+	)
 	for r := range resultsCh {
 		items = append(items, r)
+		if r.pr.Success {
+			passed = passed.With(r.code)
+		}
+		if r.pr.Error != nil {
+			failures = append(failures, Failure{Proto: r.code, Class: Classify(r.pr.Error), Err: r.pr.Error})
+		}
 	}
 
 	// 1) WebSocket priority
@@ -167,7 +266,7 @@ func (pc *ProxyChecker) Check(ctx context.Context, p domain.ProvidedProxy) (Best
 				best = it
 			}
 		}
-		return BestResult{Proto: best.code, ProtocolResult: best.pr}, nil
+		return BestResult{Proto: best.code, ProtocolResult: best.pr, Passed: passed, Failures: failures}, nil
 	}
 
 	// 2) fixed priority
@@ -175,7 +274,7 @@ func (pc *ProxyChecker) Check(ctx context.Context, p domain.ProvidedProxy) (Best
 	for _, proto := range priority {
 		for _, it := range items {
 			if it.code == proto && it.pr.Success {
-				return BestResult{Proto: proto, ProtocolResult: it.pr}, nil
+				return BestResult{Proto: proto, ProtocolResult: it.pr, Passed: passed, Failures: failures}, nil
 			}
 		}
 	}
@@ -183,15 +282,35 @@ func (pc *ProxyChecker) Check(ctx context.Context, p domain.ProvidedProxy) (Best
 	// 3) fallback
 	if len(items) > 0 {
 		it := items[0]
-		return BestResult{Proto: it.code, ProtocolResult: it.pr}, nil
+		return BestResult{Proto: it.code, ProtocolResult: it.pr, Passed: passed, Failures: failures}, nil
 	}
 
 	return BestResult{}, nil
 }
 
+// runExtras runs the WebSocket handshake and the custom URL GET over a
+// working protocol, as far as the profile wants them.
+func (pc *ProxyChecker) runExtras(ctx context.Context, proto, proxyAddr string, pr *ProtocolResult) {
+	if !pc.profile.SkipFetch || pc.profile.RequireFetch {
+		pr.FetchSuccess = pc.checkFetch(ctx, proto, proxyAddr)
+	}
+	if pc.profile.RequireFetch && !pr.FetchSuccess {
+		pr.Success = false
+		pr.Error = ErrFetchRequired
+		return
+	}
+	if !pc.profile.SkipWebSocket {
+		ws := pc.runWS(ctx, proto, proxyAddr)
+		pr.WebSocket = &ws
+	}
+}
+
 // checkFetch performs a simple GET of the FetchURL through the given proxy.
 // It returns true if the request succeeds (status code < 400).
 func (pc *ProxyChecker) checkFetch(ctx context.Context, proto, proxyAddr string) bool {
+	if err := pc.Limits.Wait(ctx, pc.FetchURL); err != nil {
+		return false
+	}
 	tr := &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
 	// set proxy or dialer
 	if proto == "http" || proto == "https" {
@@ -219,6 +338,9 @@ func (pc *ProxyChecker) checkFetch(ctx context.Context, proto, proxyAddr string)
 // runWS runs a WebSocket handshake over the given proxy. It measures
 // the time to Dial, then closes the connection with a normal close code.
 func (pc *ProxyChecker) runWS(ctx context.Context, proto, proxyAddr string) ProtocolResult {
+	if err := pc.Limits.Wait(ctx, pc.WebSocketURL); err != nil {
+		return ProtocolResult{Error: err}
+	}
 	start := time.Now()
 
 	// 1) Build an http.Transport that uses your proxy:
@@ -261,6 +383,9 @@ func (pc *ProxyChecker) runWS(ctx context.Context, proto, proxyAddr string) Prot
 
 // checkHTTP tests plain HTTP for success, latency, and IP‐leak headers.
 func (pc *ProxyChecker) checkHTTP(ctx context.Context, proxyAddr string) (bool, time.Duration, bool, error) {
+	if err := pc.Limits.Wait(ctx, pc.HTTPBinGetURL); err != nil {
+		return false, 0, false, err
+	}
 	start := time.Now()
 	tr := &http.Transport{Proxy: http.ProxyURL(&url.URL{Scheme: "http", Host: proxyAddr}), TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
 	client := &http.Client{Transport: tr, Timeout: pc.Timeout}
@@ -272,6 +397,9 @@ func (pc *ProxyChecker) checkHTTP(ctx context.Context, proxyAddr string) (bool,
 		return false, dur, false, err
 	}
 	defer resp.Body.Close()
+	if err := checkStatus(resp); err != nil {
+		return false, dur, false, err
+	}
 
 	var body struct{ Headers map[string]string }
 	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
@@ -288,19 +416,33 @@ func (pc *ProxyChecker) checkHTTP(ctx context.Context, proxyAddr string) (bool,
 
 // checkHTTPS tests HTTPS connectivity via the proxy.
 func (pc *ProxyChecker) checkHTTPS(ctx context.Context, proxyAddr string) (bool, time.Duration, error) {
+	if err := pc.Limits.Wait(ctx, pc.HTTPBinIPURL); err != nil {
+		return false, 0, err
+	}
 	start := time.Now()
 	tr := &http.Transport{Proxy: http.ProxyURL(&url.URL{Scheme: "http", Host: proxyAddr}), TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
 	client := &http.Client{Transport: tr, Timeout: pc.Timeout}
-	_, err := client.Get(pc.HTTPBinIPURL)
+	resp, err := client.Get(pc.HTTPBinIPURL)
+	if err == nil {
+		_ = resp.Body.Close()
+		err = checkStatus(resp)
+	}
 	return err == nil, time.Since(start), err
 }
 
 // checkSOCKS tests a single SOCKS proxy by issuing an HTTP GET.
 func (pc *ProxyChecker) checkSOCKS(ctx context.Context, proxyAddr, proto string) (bool, time.Duration, error) {
+	if err := pc.Limits.Wait(ctx, pc.HTTPBinGetURL); err != nil {
+		return false, 0, err
+	}
 	start := time.Now()
 	dial := socks.Dial(fmt.Sprintf("%s://%s?timeout=%s", proto, proxyAddr, pc.Timeout))
 	tr := &http.Transport{DialContext: func(_ context.Context, network, addr string) (net.Conn, error) { return dial(network, addr) }, TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
 	client := &http.Client{Transport: tr, Timeout: pc.Timeout}
-	_, err := client.Get(pc.HTTPBinGetURL)
+	resp, err := client.Get(pc.HTTPBinGetURL)
+	if err == nil {
+		_ = resp.Body.Close()
+		err = checkStatus(resp)
+	}
 	return err == nil, time.Since(start), err
 }
@@ -0,0 +1,48 @@
+package proxytest
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/yuridevx/proxylist/pkg/config"
+	"golang.org/x/time/rate"
+)
+
+// HostLimits holds a token bucket per destination host shared by every
+// checker, so the judge, websocket echo and fetch targets see a bounded
+// request rate no matter how many workers run. A nil HostLimits and hosts
+// without a configured limit are not limited.
+type HostLimits struct {
+	limiters map[string]*rate.Limiter
+}
+
+// NewHostLimits creates the buckets for the configured hosts. Hosts without
+// a positive rate are left unlimited rather than blocked.
+func NewHostLimits(limits map[string]config.RateLimit) *HostLimits {
+	h := &HostLimits{limiters: make(map[string]*rate.Limiter, len(limits))}
+	for host, l := range limits {
+		if l.Rate <= 0 {
+			continue
+		}
+		h.limiters[strings.ToLower(host)] = rate.NewLimiter(rate.Limit(l.Rate), max(l.Burst, 1))
+	}
+	return h
+}
+
+// Wait blocks until a request to rawURL is within budget. It only fails
+// when ctx is done first.
+func (h *HostLimits) Wait(ctx context.Context, rawURL string) error {
+	if h == nil {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil
+	}
+	limiter, ok := h.limiters[strings.ToLower(u.Hostname())]
+	if !ok {
+		return nil
+	}
+	return limiter.Wait(ctx)
+}
@@ -0,0 +1,35 @@
+package proxytest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/yuridevx/proxylist/pkg/config"
+)
+
+func TestHostLimits(t *testing.T) {
+	h := NewHostLimits(map[string]config.RateLimit{
+		"Judge.test": {Rate: 0.001, Burst: 1},
+		"unset.test": {},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	tests := []struct {
+		url string
+		ok  bool
+	}{
+		{"http://judge.test/get", true},
+		// the burst is spent
+		{"https://JUDGE.test/ip", false},
+		{"http://unset.test/get", true},
+		{"http://unset.test/get", true},
+		{"http://other.test/", true},
+	}
+	for _, tt := range tests {
+		if err := h.Wait(ctx, tt.url); (err == nil) != tt.ok {
+			t.Errorf("Wait(%s) = %v, want ok %v", tt.url, err, tt.ok)
+		}
+	}
+}
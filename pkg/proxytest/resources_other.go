@@ -0,0 +1,11 @@
+//go:build !unix
+
+package proxytest
+
+import "time"
+
+// sampleResources only knows the time on platforms without rlimits, so the
+// adaptive limit is driven by goroutines and timeouts alone.
+func sampleResources() resources {
+	return resources{sampleAt: time.Now()}
+}
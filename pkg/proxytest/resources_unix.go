@@ -0,0 +1,30 @@
+//go:build unix
+
+package proxytest
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+func sampleResources() resources {
+	r := resources{sampleAt: time.Now()}
+
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err == nil {
+		r.fdLimit = int(limit.Cur)
+	}
+	for _, dir := range []string{"/proc/self/fd", "/dev/fd"} {
+		if entries, err := os.ReadDir(dir); err == nil {
+			r.fds = len(entries)
+			break
+		}
+	}
+
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err == nil {
+		r.cpuTime = time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+	}
+	return r
+}
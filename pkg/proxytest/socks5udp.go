@@ -0,0 +1,163 @@
+package proxytest
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// socks5UDP is a net.PacketConn relaying datagrams through a SOCKS5 UDP
+// ASSOCIATE (RFC 1928, section 7). The association lives as long as the
+// control connection stays open. The UDP socket is not embedded so QUIC
+// cannot bypass the header handling through ReadMsgUDP.
+type socks5UDP struct {
+	conn    *net.UDPConn
+	control net.Conn
+	relay   *net.UDPAddr
+}
+
+// dialSOCKS5UDP asks the SOCKS5 proxy at proxyAddr for a UDP relay.
+func dialSOCKS5UDP(ctx context.Context, proxyAddr string) (*socks5UDP, error) {
+	control, err := (&net.Dialer{}).DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = control.SetDeadline(deadline)
+	}
+
+	relay, err := associate(control)
+	if err != nil {
+		_ = control.Close()
+		return nil, err
+	}
+	// relays announced on an unspecified address live on the proxy host
+	if relay.IP.IsUnspecified() {
+		host, _, _ := net.SplitHostPort(proxyAddr)
+		relay.IP = net.ParseIP(host)
+	}
+
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		_ = control.Close()
+		return nil, err
+	}
+	_ = control.SetDeadline(time.Time{})
+	return &socks5UDP{conn: conn, control: control, relay: relay}, nil
+}
+
+func associate(control net.Conn) (*net.UDPAddr, error) {
+	// greeting: version 5, one method, no authentication
+	if _, err := control.Write([]byte{0x05, 0x01, 0x00}); err != nil {
+		return nil, err
+	}
+	greeting := make([]byte, 2)
+	if _, err := io.ReadFull(control, greeting); err != nil {
+		return nil, err
+	}
+	if greeting[0] != 0x05 || greeting[1] != 0x00 {
+		return nil, errors.New("socks5: no acceptable authentication method")
+	}
+
+	// UDP ASSOCIATE with the client address left unspecified
+	if _, err := control.Write([]byte{0x05, 0x03, 0x00, 0x01, 0, 0, 0, 0, 0, 0}); err != nil {
+		return nil, err
+	}
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(control, head); err != nil {
+		return nil, err
+	}
+	if head[1] != 0x00 {
+		return nil, fmt.Errorf("socks5: udp associate rejected with code %d", head[1])
+	}
+
+	var ip []byte
+	switch head[3] {
+	case 0x01:
+		ip = make([]byte, net.IPv4len)
+	case 0x04:
+		ip = make([]byte, net.IPv6len)
+	default:
+		return nil, fmt.Errorf("socks5: unsupported relay address type %d", head[3])
+	}
+	if _, err := io.ReadFull(control, ip); err != nil {
+		return nil, err
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(control, port); err != nil {
+		return nil, err
+	}
+	return &net.UDPAddr{IP: ip, Port: int(binary.BigEndian.Uint16(port))}, nil
+}
+
+// WriteTo wraps p in the SOCKS5 UDP request header and sends it to the relay.
+func (c *socks5UDP) WriteTo(p []byte, addr net.Addr) (int, error) {
+	udpAddr, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return 0, fmt.Errorf("socks5: unsupported address %v", addr)
+	}
+
+	header := []byte{0, 0, 0, 0x01}
+	ip := udpAddr.IP.To4()
+	if ip == nil {
+		header[3] = 0x04
+		ip = udpAddr.IP.To16()
+	}
+	header = append(header, ip...)
+	header = binary.BigEndian.AppendUint16(header, uint16(udpAddr.Port))
+
+	if _, err := c.conn.WriteTo(append(header, p...), c.relay); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// ReadFrom strips the SOCKS5 UDP header and reports the original sender.
+func (c *socks5UDP) ReadFrom(p []byte) (int, net.Addr, error) {
+	buf := make([]byte, len(p)+22)
+	for {
+		n, _, err := c.conn.ReadFrom(buf)
+		if err != nil {
+			return 0, nil, err
+		}
+		if n < 4 || buf[2] != 0 {
+			// fragmented or malformed datagrams are dropped
+			continue
+		}
+
+		var ipLen int
+		switch buf[3] {
+		case 0x01:
+			ipLen = net.IPv4len
+		case 0x04:
+			ipLen = net.IPv6len
+		default:
+			continue
+		}
+		offset := 4 + ipLen + 2
+		if n < offset {
+			continue
+		}
+		from := &net.UDPAddr{
+			IP:   net.IP(append([]byte(nil), buf[4:4+ipLen]...)),
+			Port: int(binary.BigEndian.Uint16(buf[4+ipLen : offset])),
+		}
+		return copy(p, buf[offset:n]), from, nil
+	}
+}
+
+func (c *socks5UDP) Close() error {
+	_ = c.control.Close()
+	return c.conn.Close()
+}
+
+func (c *socks5UDP) LocalAddr() net.Addr                { return c.conn.LocalAddr() }
+func (c *socks5UDP) SetDeadline(t time.Time) error      { return c.conn.SetDeadline(t) }
+func (c *socks5UDP) SetReadDeadline(t time.Time) error  { return c.conn.SetReadDeadline(t) }
+func (c *socks5UDP) SetWriteDeadline(t time.Time) error { return c.conn.SetWriteDeadline(t) }
+func (c *socks5UDP) SetReadBuffer(bytes int) error      { return c.conn.SetReadBuffer(bytes) }
+func (c *socks5UDP) SetWriteBuffer(bytes int) error     { return c.conn.SetWriteBuffer(bytes) }
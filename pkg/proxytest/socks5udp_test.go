@@ -0,0 +1,86 @@
+package proxytest
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSOCKS5UDPFraming(t *testing.T) {
+	relay, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer relay.Close()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	control, _ := net.Pipe()
+	c := &socks5UDP{conn: conn, control: control, relay: relay.LocalAddr().(*net.UDPAddr)}
+	defer c.Close()
+	_ = relay.SetDeadline(time.Now().Add(5 * time.Second))
+	_ = c.SetDeadline(time.Now().Add(5 * time.Second))
+
+	tests := []struct {
+		dst    *net.UDPAddr
+		header []byte
+	}{
+		{&net.UDPAddr{IP: net.ParseIP("203.0.113.7"), Port: 443}, []byte{0, 0, 0, 0x01, 203, 0, 113, 7, 0x01, 0xbb}},
+		{&net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 53}, append(append([]byte{0, 0, 0, 0x04}, net.ParseIP("2001:db8::1")...), 0x00, 0x35)},
+	}
+	buf := make([]byte, 1500)
+	for _, tt := range tests {
+		if n, err := c.WriteTo([]byte("ping"), tt.dst); err != nil || n != 4 {
+			t.Fatalf("WriteTo(%s) = %d, %v", tt.dst, n, err)
+		}
+		n, from, err := relay.ReadFromUDP(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := append(tt.header, "ping"...); !bytes.Equal(buf[:n], want) {
+			t.Errorf("datagram to %s = %v, want %v", tt.dst, buf[:n], want)
+		}
+
+		// a fragment and a truncated header are dropped before the answer
+		_, _ = relay.WriteToUDP(append([]byte{0, 0, 1}, tt.header[3:]...), from)
+		_, _ = relay.WriteToUDP(tt.header[:5], from)
+		_, _ = relay.WriteToUDP(append(tt.header, "pong"...), from)
+
+		n, src, err := c.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(buf[:n]); got != "pong" || src.String() != tt.dst.String() {
+			t.Errorf("ReadFrom = %q from %s, want \"pong\" from %s", got, src, tt.dst)
+		}
+	}
+}
+
+func TestSOCKS5Associate(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		defer server.Close()
+		greeting := make([]byte, 3)
+		if _, err := io.ReadFull(server, greeting); err != nil {
+			return
+		}
+		_, _ = server.Write([]byte{0x05, 0x00})
+		request := make([]byte, 10)
+		if _, err := io.ReadFull(server, request); err != nil || request[1] != 0x03 {
+			return
+		}
+		_, _ = server.Write([]byte{0x05, 0x00, 0x00, 0x01, 198, 51, 100, 9, 0x1f, 0x90})
+	}()
+
+	relay, err := associate(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if relay.String() != "198.51.100.9:8080" {
+		t.Errorf("relay = %s, want 198.51.100.9:8080", relay)
+	}
+}
@@ -0,0 +1,124 @@
+package proxytest
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+// WSStabilityTest keeps a websocket open through the proxy for Duration and
+// sends an echo message every Interval.
+type WSStabilityTest struct {
+	Duration time.Duration
+	Interval time.Duration
+}
+
+// WSStability is the outcome of a WSStabilityTest. Stability is the share of
+// the planned echo messages that were answered, so a session dropped
+// halfway scores about 0.5.
+type WSStability struct {
+	Sent      int
+	Received  int
+	Stability float64
+	RTT       time.Duration // mean echo round trip
+	Uptime    time.Duration // how long the session stayed open
+	Dropped   bool
+	Error     error
+}
+
+func (pc *ProxyChecker) measureWSStability(ctx context.Context, proto Protocol, proxyAddr string) WSStability {
+	var res WSStability
+	if err := pc.Limits.Wait(ctx, pc.WebSocketURL); err != nil {
+		res.Error = err
+		return res
+	}
+
+	conn, _, err := websocket.Dial(ctx, pc.WebSocketURL, &websocket.DialOptions{
+		HTTPClient: pc.proxyClient(proto, proxyAddr),
+	})
+	if err != nil {
+		res.Error = err
+		return res
+	}
+	defer conn.CloseNow()
+
+	// messages the echo server sends on its own, such as a greeting, are
+	// skipped while waiting for the reply
+	replies := make(chan string)
+	readCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		defer close(replies)
+		for {
+			_, data, err := conn.Read(readCtx)
+			if err != nil {
+				return
+			}
+			select {
+			case replies <- string(data):
+			case <-readCtx.Done():
+				return
+			}
+		}
+	}()
+
+	start := time.Now()
+	var total time.Duration
+	ticker := time.NewTicker(pc.WSStability.Interval)
+	defer ticker.Stop()
+
+session:
+	for seq := 0; time.Since(start) < pc.WSStability.Duration; seq++ {
+		msg := "proxylist-" + strconv.Itoa(seq)
+		sent := time.Now()
+		res.Sent++
+		if err := conn.Write(ctx, websocket.MessageText, []byte(msg)); err != nil {
+			res.Dropped, res.Error = true, err
+			break
+		}
+
+		timeout := time.NewTimer(pc.Timeout)
+	wait:
+		for {
+			select {
+			case reply, ok := <-replies:
+				if !ok {
+					timeout.Stop()
+					res.Dropped = true
+					break session
+				}
+				if reply == msg {
+					res.Received++
+					total += time.Since(sent)
+					break wait
+				}
+			case <-timeout.C:
+				// a lost echo counts against stability but the session goes on
+				break wait
+			case <-ctx.Done():
+				timeout.Stop()
+				break session
+			}
+		}
+		timeout.Stop()
+
+		select {
+		case <-ctx.Done():
+			break session
+		case <-ticker.C:
+		}
+	}
+
+	res.Uptime = time.Since(start)
+	planned := max(int(pc.WSStability.Duration/pc.WSStability.Interval), 1)
+	res.Stability = min(float64(res.Received)/float64(planned), 1)
+	if res.Received > 0 {
+		res.RTT = total / time.Duration(res.Received)
+	}
+	if !res.Dropped {
+		_ = conn.Close(websocket.StatusNormalClosure, "")
+	}
+	return res
+}
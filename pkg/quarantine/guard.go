@@ -0,0 +1,228 @@
+package quarantine
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v5"
+	"github.com/yuridevx/proxylist/pkg/config"
+	"github.com/yuridevx/proxylist/pkg/reconciler"
+	"github.com/yuridevx/proxylist/pkg/stats"
+	"go.uber.org/zap"
+)
+
+// State is where a provider stands in the quarantine lifecycle.
+type State string
+
+const (
+	StateHealthy     State = "healthy"
+	StateSlowed      State = "slowed"
+	StateQuarantined State = "quarantined"
+)
+
+const (
+	reasonFailures = "repeated fetch failures"
+	reasonLowYield = "low yield"
+)
+
+// Status is a point in time view of a guarded provider.
+type Status struct {
+	Provider  string    `json:"provider"`
+	State     State     `json:"state"`
+	Reason    string    `json:"reason,omitempty"`
+	Slowdowns int       `json:"slowdowns"`
+	Failures  int       `json:"failures"`
+	Yield     float64   `json:"yield"`
+	Since     time.Time `json:"since"`
+}
+
+// Guard wraps a provider reconcile and stretches its schedule when the
+// provider keeps failing or its proxies rarely pass checks. A quarantined
+// provider only runs on the probe interval until it recovers.
+type Guard struct {
+	provider  string
+	conf      config.QuarantineConfig
+	collector *stats.Collector
+	log       *zap.Logger
+	interval  backoff.BackOff
+	fail      backoff.BackOff
+
+	mu        sync.Mutex
+	state     State
+	reason    string
+	since     time.Time
+	slowdowns int
+	failures  int
+	yield     float64
+	checked   int64
+	passed    int64
+}
+
+// NewGuard guards provider, whose regular wait between runs is interval.
+func NewGuard(provider string, conf config.QuarantineConfig, collector *stats.Collector, log *zap.Logger, interval backoff.BackOff) *Guard {
+	return &Guard{
+		provider:  provider,
+		conf:      conf,
+		collector: collector,
+		log:       log.With(zap.String("provider", provider)),
+		interval:  interval,
+		fail:      backoff.NewExponentialBackOff(),
+		state:     StateHealthy,
+		since:     time.Now(),
+		yield:     1,
+	}
+}
+
+// Wrap returns fn counting consecutive failures.
+func (g *Guard) Wrap(fn func(ctx context.Context) error) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		err := fn(ctx)
+		if ctx.Err() != nil {
+			return err
+		}
+
+		g.mu.Lock()
+		defer g.mu.Unlock()
+
+		if err != nil {
+			g.failures++
+			if g.failures >= g.conf.MaxFailures && g.state != StateQuarantined {
+				g.setState(StateQuarantined, reasonFailures)
+			}
+			return err
+		}
+
+		g.failures = 0
+		if g.state == StateQuarantined && g.reason == reasonFailures {
+			g.setState(StateHealthy, "")
+		}
+		return nil
+	}
+}
+
+// Options plugs the guard into a reconciler.Runner.
+func (g *Guard) Options() []reconciler.RunnerOption {
+	return []reconciler.RunnerOption{
+		reconciler.WithWaitBackOff(waitBackOff{g}),
+		reconciler.WithFailBackOff(failBackOff{g}),
+	}
+}
+
+// Status returns the current state of the guarded provider.
+func (g *Guard) Status() Status {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return Status{
+		Provider:  g.provider,
+		State:     g.state,
+		Reason:    g.reason,
+		Slowdowns: g.slowdowns,
+		Failures:  g.failures,
+		Yield:     g.yield,
+		Since:     g.since,
+	}
+}
+
+// evaluate updates the yield from the checks finished since the last
+// evaluation and returns the wait before the next run.
+func (g *Guard) evaluate() time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var checked, passed int64
+	for _, p := range g.collector.Snapshot() {
+		if p.Name == g.provider {
+			checked, passed = p.Checked, p.Passed
+		}
+	}
+
+	if delta := checked - g.checked; delta >= int64(g.conf.MinChecked) {
+		g.yield = float64(passed-g.passed) / float64(delta)
+		g.checked, g.passed = checked, passed
+
+		switch {
+		case g.yield >= g.conf.MinYield:
+			if g.state != StateHealthy {
+				g.setState(StateHealthy, "")
+			}
+			g.slowdowns = 0
+		case g.slowdowns >= g.conf.MaxSlowdowns:
+			if g.state != StateQuarantined {
+				g.setState(StateQuarantined, reasonLowYield)
+			}
+		default:
+			g.slowdowns++
+			g.setState(StateSlowed, reasonLowYield)
+		}
+	}
+
+	if g.state == StateQuarantined {
+		return g.conf.ProbeInterval
+	}
+	wait := g.interval.NextBackOff()
+	return time.Duration(float64(wait) * math.Pow(g.conf.Multiplier, float64(g.slowdowns)))
+}
+
+func (g *Guard) failWait() time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.state == StateQuarantined {
+		return g.conf.ProbeInterval
+	}
+	return g.fail.NextBackOff()
+}
+
+func (g *Guard) setState(state State, reason string) {
+	g.log.Info("provider quarantine state changed",
+		zap.String("from", string(g.state)),
+		zap.String("to", string(state)),
+		zap.String("reason", reason),
+		zap.Float64("yield", g.yield),
+		zap.Int("failures", g.failures),
+	)
+	g.state = state
+	g.reason = reason
+	g.since = time.Now()
+}
+
+type waitBackOff struct{ g *Guard }
+
+func (b waitBackOff) NextBackOff() time.Duration { return b.g.evaluate() }
+func (b waitBackOff) Reset()                     {}
+
+type failBackOff struct{ g *Guard }
+
+func (b failBackOff) NextBackOff() time.Duration { return b.g.failWait() }
+func (b failBackOff) Reset() {
+	b.g.mu.Lock()
+	defer b.g.mu.Unlock()
+	b.g.fail.Reset()
+}
+
+// Registry collects guards so their state can be reported.
+type Registry struct {
+	mu     sync.Mutex
+	guards []*Guard
+}
+
+func (r *Registry) Add(g *Guard) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.guards = append(r.guards, g)
+}
+
+// Statuses returns the state of every registered guard.
+func (r *Registry) Statuses() []Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	list := make([]Status, 0, len(r.guards))
+	for _, g := range r.guards {
+		list = append(list, g.Status())
+	}
+	return list
+}
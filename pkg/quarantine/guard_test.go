@@ -0,0 +1,124 @@
+package quarantine
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v5"
+	"github.com/yuridevx/proxylist/pkg/config"
+	"github.com/yuridevx/proxylist/pkg/stats"
+	"go.uber.org/zap"
+)
+
+var testConf = config.QuarantineConfig{
+	Enabled:       true,
+	MinChecked:    10,
+	MinYield:      0.2,
+	MaxFailures:   3,
+	Multiplier:    2,
+	MaxSlowdowns:  2,
+	ProbeInterval: time.Hour,
+}
+
+func newTestGuard(collector *stats.Collector) *Guard {
+	return NewGuard("p", testConf, collector, zap.NewNop(), backoff.NewConstantBackOff(time.Minute))
+}
+
+func TestGuardYield(t *testing.T) {
+	collector := stats.NewCollector(nil, zap.NewNop())
+	g := newTestGuard(collector)
+
+	tests := []struct {
+		name            string
+		checked, passed int
+		state           State
+		slowdowns       int
+		wait            time.Duration
+	}{
+		{"too few checks", 5, 0, StateHealthy, 0, time.Minute},
+		{"low yield", 5, 0, StateSlowed, 1, 2 * time.Minute},
+		{"still low", 10, 1, StateSlowed, 2, 4 * time.Minute},
+		{"out of slowdowns", 10, 0, StateQuarantined, 2, time.Hour},
+		{"no new checks", 0, 0, StateQuarantined, 2, time.Hour},
+		{"recovered", 10, 5, StateHealthy, 0, time.Minute},
+	}
+	for _, tt := range tests {
+		for i := 0; i < tt.checked; i++ {
+			collector.RecordCheck("p", i < tt.passed)
+		}
+		// checks of other providers do not count
+		collector.RecordCheck("other", false)
+
+		wait := g.evaluate()
+		st := g.Status()
+		if st.State != tt.state || st.Slowdowns != tt.slowdowns || wait != tt.wait {
+			t.Errorf("%s: %s with %d slowdowns, wait %s; want %s with %d, wait %s",
+				tt.name, st.State, st.Slowdowns, wait, tt.state, tt.slowdowns, tt.wait)
+		}
+	}
+}
+
+func TestGuardFailures(t *testing.T) {
+	g := newTestGuard(stats.NewCollector(nil, zap.NewNop()))
+	fail := errors.New("fetch failed")
+	var result error
+	run := g.Wrap(func(context.Context) error { return result })
+
+	result = fail
+	for i := 1; i < testConf.MaxFailures; i++ {
+		_ = run(context.Background())
+		if st := g.Status(); st.State != StateHealthy || st.Failures != i {
+			t.Fatalf("after %d failures: %+v, want healthy", i, st)
+		}
+		if wait := g.failWait(); wait <= 0 || wait >= testConf.ProbeInterval {
+			t.Errorf("after %d failures: fail wait %s, want the regular backoff", i, wait)
+		}
+	}
+
+	// a cancelled run says nothing about the provider
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_ = run(ctx)
+	if st := g.Status(); st.Failures != testConf.MaxFailures-1 {
+		t.Errorf("cancelled run counted: %d failures", st.Failures)
+	}
+
+	_ = run(context.Background())
+	if st := g.Status(); st.State != StateQuarantined || st.Reason != reasonFailures {
+		t.Fatalf("after %d failures: %+v, want quarantined", testConf.MaxFailures, st)
+	}
+	if wait := g.failWait(); wait != testConf.ProbeInterval {
+		t.Errorf("quarantined fail wait %s, want the probe interval", wait)
+	}
+	if wait := g.evaluate(); wait != testConf.ProbeInterval {
+		t.Errorf("quarantined wait %s, want the probe interval", wait)
+	}
+
+	result = nil
+	_ = run(context.Background())
+	if st := g.Status(); st.State != StateHealthy || st.Failures != 0 {
+		t.Errorf("after a successful probe: %+v, want healthy", st)
+	}
+}
+
+func TestGuardLowYieldOutlastsSuccess(t *testing.T) {
+	collector := stats.NewCollector(nil, zap.NewNop())
+	g := newTestGuard(collector)
+	for i := 0; i <= testConf.MaxSlowdowns; i++ {
+		for j := 0; j < testConf.MinChecked; j++ {
+			collector.RecordCheck("p", false)
+		}
+		g.evaluate()
+	}
+	if st := g.Status(); st.State != StateQuarantined || st.Reason != reasonLowYield {
+		t.Fatalf("%+v, want quarantined for low yield", st)
+	}
+
+	// a working fetch does not lift a low yield quarantine
+	_ = g.Wrap(func(context.Context) error { return nil })(context.Background())
+	if st := g.Status(); st.State != StateQuarantined {
+		t.Errorf("after a successful fetch: %+v, want still quarantined", st)
+	}
+}
@@ -0,0 +1,239 @@
+package queue
+
+import (
+	"container/heap"
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/yuridevx/proxylist/domain"
+)
+
+// Score bonuses added to the provider priority of a queued proxy.
+const (
+	RetestBonus    = 1000
+	KnownGoodBonus = 100
+	FreshBonus     = 10
+)
+
+// History answers what is known about a proxy from earlier checks.
+type History interface {
+	Seen(p domain.ProvidedProxy) bool
+	Good(p domain.ProvidedProxy) bool
+}
+
+// Depth is the number of queued proxies of one provider.
+type Depth struct {
+	Provider string `json:"provider"`
+	Queued   int    `json:"queued"`
+	Pushed   uint64 `json:"pushed"`
+	Popped   uint64 `json:"popped"`
+}
+
+// Queue sits between the providers and the proxy sink. Every provider gets
+// its own bounded lane, so a huge list only blocks itself. Proxies leave
+// the queue by score (manual retests, then previously good proxies, then
+// provider priority, then never seen ones) and lanes with equal scores are
+// served round robin.
+type Queue struct {
+	history  History
+	capacity int
+	out      chan domain.ProvidedProxy
+	ready    chan struct{}
+
+	mu    sync.Mutex
+	lanes map[string]*lane
+	names []string
+	next  int
+	seq   uint64
+}
+
+type item struct {
+	proxy domain.ProvidedProxy
+	score int
+	seq   uint64
+}
+
+type lane struct {
+	items  items
+	space  chan struct{}
+	pushed uint64
+	popped uint64
+}
+
+// New creates a queue holding at most capacity proxies per provider.
+// history may be nil, in which case only the provider priority counts.
+func New(history History, capacity int) *Queue {
+	return &Queue{
+		history:  history,
+		capacity: max(capacity, 1),
+		out:      make(chan domain.ProvidedProxy),
+		ready:    make(chan struct{}, 1),
+		lanes:    make(map[string]*lane),
+	}
+}
+
+// Out is the channel the proxy sink reads from.
+func (q *Queue) Out() <-chan domain.ProvidedProxy {
+	return q.out
+}
+
+// Input returns a channel feeding the lane of provider. Sends block only
+// while that lane is full.
+func (q *Queue) Input(ctx context.Context, provider string) chan<- domain.ProvidedProxy {
+	in := make(chan domain.ProvidedProxy)
+	l := q.lane(provider)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case p := <-in:
+				if !q.push(ctx, l, p) {
+					return
+				}
+			}
+		}
+	}()
+	return in
+}
+
+// Run dispatches queued proxies to Out until ctx is done.
+func (q *Queue) Run(ctx context.Context) {
+	for {
+		p, ok := q.pop()
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return
+			case <-q.ready:
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case q.out <- p:
+		}
+	}
+}
+
+// Depths returns the lane sizes ordered by provider.
+func (q *Queue) Depths() []Depth {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	list := make([]Depth, 0, len(q.lanes))
+	for name, l := range q.lanes {
+		list = append(list, Depth{Provider: name, Queued: len(l.items), Pushed: l.pushed, Popped: l.popped})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Provider < list[j].Provider })
+	return list
+}
+
+func (q *Queue) lane(provider string) *lane {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	l, ok := q.lanes[provider]
+	if !ok {
+		l = &lane{space: make(chan struct{}, 1)}
+		q.lanes[provider] = l
+		q.names = append(q.names, provider)
+	}
+	return l
+}
+
+func (q *Queue) score(p domain.ProvidedProxy) int {
+	score := p.Priority
+	if p.Retest {
+		score += RetestBonus
+	}
+	if q.history != nil {
+		if q.history.Good(p) {
+			score += KnownGoodBonus
+		} else if !q.history.Seen(p) {
+			score += FreshBonus
+		}
+	}
+	return score
+}
+
+// push adds p to l, waiting for space. It returns false when ctx is done.
+func (q *Queue) push(ctx context.Context, l *lane, p domain.ProvidedProxy) bool {
+	score := q.score(p)
+	for {
+		q.mu.Lock()
+		if len(l.items) < q.capacity {
+			q.seq++
+			heap.Push(&l.items, item{proxy: p, score: score, seq: q.seq})
+			l.pushed++
+			q.mu.Unlock()
+			signal(q.ready)
+			return true
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-l.space:
+		}
+	}
+}
+
+// pop removes the best scored head across all lanes, rotating between
+// lanes whose heads score the same.
+func (q *Queue) pop() (domain.ProvidedProxy, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	best := -1
+	for i := range q.names {
+		idx := (q.next + i) % len(q.names)
+		l := q.lanes[q.names[idx]]
+		if len(l.items) == 0 {
+			continue
+		}
+		if best < 0 || l.items[0].score > q.lanes[q.names[best]].items[0].score {
+			best = idx
+		}
+	}
+	if best < 0 {
+		return domain.ProvidedProxy{}, false
+	}
+
+	l := q.lanes[q.names[best]]
+	it := heap.Pop(&l.items).(item)
+	l.popped++
+	q.next = best + 1
+	signal(l.space)
+	return it.proxy, true
+}
+
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// items is a max-heap by score, first in first out within a score.
+type items []item
+
+func (h items) Len() int { return len(h) }
+func (h items) Less(i, j int) bool {
+	if h[i].score != h[j].score {
+		return h[i].score > h[j].score
+	}
+	return h[i].seq < h[j].seq
+}
+func (h items) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *items) Push(x any)   { *h = append(*h, x.(item)) }
+func (h *items) Pop() any {
+	old := *h
+	it := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return it
+}
@@ -0,0 +1,118 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/yuridevx/proxylist/domain"
+)
+
+type history struct {
+	seen map[int]bool
+	good map[int]bool
+}
+
+func (h history) Seen(p domain.ProvidedProxy) bool { return h.seen[p.Port] }
+func (h history) Good(p domain.ProvidedProxy) bool { return h.good[p.Port] }
+
+func proxy(provider string, port int) domain.ProvidedProxy {
+	return domain.ProvidedProxy{IP: "1.2.3.4", Port: port, Provider: provider}
+}
+
+func drain(q *Queue) []int {
+	var ports []int
+	for {
+		p, ok := q.pop()
+		if !ok {
+			return ports
+		}
+		ports = append(ports, p.Port)
+	}
+}
+
+func equal(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPopOrder(t *testing.T) {
+	ctx := context.Background()
+	q := New(history{
+		seen: map[int]bool{1: true, 2: true, 5: true},
+		good: map[int]bool{2: true},
+	}, 10)
+	l := q.lane("a")
+
+	retest := proxy("a", 4)
+	retest.Retest = true
+	important := proxy("a", 5)
+	important.Priority = 50
+
+	// seen, known good, never seen, retest, seen with priority
+	for _, p := range []domain.ProvidedProxy{proxy("a", 1), proxy("a", 2), proxy("a", 3), retest, important} {
+		q.push(ctx, l, p)
+	}
+
+	if got, want := drain(q), []int{4, 2, 5, 3, 1}; !equal(got, want) {
+		t.Errorf("pop order = %v, want %v", got, want)
+	}
+}
+
+func TestPopRoundRobin(t *testing.T) {
+	ctx := context.Background()
+	q := New(nil, 10)
+	a, b := q.lane("a"), q.lane("b")
+	for port := 1; port <= 3; port++ {
+		q.push(ctx, a, proxy("a", port))
+		q.push(ctx, b, proxy("b", 10+port))
+	}
+
+	// equal scores alternate between lanes and stay first in first out within one
+	if got, want := drain(q), []int{1, 11, 2, 12, 3, 13}; !equal(got, want) {
+		t.Errorf("pop order = %v, want %v", got, want)
+	}
+}
+
+func TestLaneCapacity(t *testing.T) {
+	q := New(nil, 2)
+	full, other := q.lane("full"), q.lane("other")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if !q.push(ctx, full, proxy("full", 1)) || !q.push(ctx, full, proxy("full", 2)) {
+		t.Fatal("push into a lane with space failed")
+	}
+	if q.push(ctx, full, proxy("full", 3)) {
+		t.Fatal("push into a full lane did not block")
+	}
+	// a full lane only blocks itself
+	if !q.push(context.Background(), other, proxy("other", 4)) {
+		t.Fatal("push into another lane failed")
+	}
+
+	done := make(chan bool)
+	go func() { done <- q.push(context.Background(), full, proxy("full", 5)) }()
+	if _, ok := q.pop(); !ok {
+		t.Fatal("pop from a filled queue failed")
+	}
+	select {
+	case ok := <-done:
+		if !ok {
+			t.Fatal("blocked push failed after pop")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("blocked push not released by pop")
+	}
+
+	if depths := q.Depths(); depths[0].Queued != 2 || depths[0].Pushed != 3 {
+		t.Errorf("full lane depth = %+v, want 2 queued of 3 pushed", depths[0])
+	}
+}
@@ -0,0 +1,66 @@
+package reconciler
+
+import (
+	"slices"
+	"sync"
+)
+
+// Named is a runner registered under a name and optional tags.
+type Named struct {
+	Name   string   `json:"name"`
+	Tags   []string `json:"tags,omitempty"`
+	Runner *Runner  `json:"-"`
+	State  State    `json:"state"`
+}
+
+// Registry keeps runners addressable by name or tag so they can be triggered on demand.
+type Registry struct {
+	mu      sync.Mutex
+	runners []Named
+}
+
+func (r *Registry) Add(name string, tags []string, runner *Runner) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.runners = append(r.runners, Named{Name: name, Tags: tags, Runner: runner})
+}
+
+// Trigger runs every runner whose name or one of its tags equals key
+// and returns how many were triggered.
+func (r *Registry) Trigger(key string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	for _, named := range r.runners {
+		if named.Name == key || slices.Contains(named.Tags, key) {
+			named.Runner.Trigger()
+			n++
+		}
+	}
+	return n
+}
+
+// TriggerAll runs every registered runner.
+func (r *Registry) TriggerAll() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, named := range r.runners {
+		named.Runner.Trigger()
+	}
+	return len(r.runners)
+}
+
+// States returns every runner with its current state.
+func (r *Registry) States() []Named {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	list := make([]Named, 0, len(r.runners))
+	for _, named := range r.runners {
+		named.State = named.Runner.State()
+		list = append(list, named)
+	}
+	return list
+}
@@ -3,13 +3,40 @@ package reconciler
 import (
 	"context"
 	"github.com/cenkalti/backoff/v5"
+	"github.com/robfig/cron/v3"
+	"math/rand/v2"
+	"sync"
 	"time"
 )
 
+// scheduleSlack is how far before the end of a wait a tick still counts.
+const scheduleSlack = time.Second
+
 type Runner struct {
 	FailBackOff backoff.BackOff
 	WaitBackOff backoff.BackOff
 	ReconcileFn func(ctx context.Context) error
+	// Schedule aligns runs to its ticks when set. Runs wait for the first
+	// tick after WaitBackOff, so a backoff can stretch the schedule.
+	Schedule cron.Schedule
+	// WaitFirst delays the first run by one wait instead of running at startup.
+	WaitFirst bool
+	// StartupJitter delays the first run by a random duration up to this value.
+	StartupJitter time.Duration
+
+	trigger chan struct{}
+	mu      sync.Mutex
+	state   State
+}
+
+// State describes the runs of a Runner.
+type State struct {
+	Running      bool          `json:"running"`
+	Runs         int           `json:"runs"`
+	LastRun      time.Time     `json:"last_run"`
+	LastDuration time.Duration `json:"last_duration"`
+	LastErr      string        `json:"last_error,omitempty"`
+	NextRun      time.Time     `json:"next_run"`
 }
 
 type RunnerOption func(*Runner)
@@ -26,19 +53,178 @@ func WithWaitBackOff(b backoff.BackOff) RunnerOption {
 	}
 }
 
+// WithInterval waits interval between successful runs, randomly shifted by up to jitter in either direction.
+func WithInterval(interval, jitter time.Duration) RunnerOption {
+	return WithWaitBackOff(&JitterBackOff{Interval: interval, Jitter: jitter})
+}
+
+// WithCron schedules successful runs by a standard five field cron
+// expression or a descriptor such as @daily.
+func WithCron(expr string) (RunnerOption, error) {
+	b, err := NewScheduleBackOff(expr)
+	if err != nil {
+		return nil, err
+	}
+	return WithSchedule(b), nil
+}
+
+// WithSchedule runs on the ticks of b. A wait backoff set after it, such as
+// a quarantine guard built on b, may delay runs by whole ticks.
+func WithSchedule(b *ScheduleBackOff) RunnerOption {
+	return func(r *Runner) {
+		r.Schedule = b.Schedule
+		r.WaitBackOff = b
+	}
+}
+
+// WithWaitFirst waits one interval before the first run.
+func WithWaitFirst(waitFirst bool) RunnerOption {
+	return func(r *Runner) {
+		r.WaitFirst = waitFirst
+	}
+}
+
+// WithStartupJitter spreads the first run of many runners over up to d.
+func WithStartupJitter(d time.Duration) RunnerOption {
+	return func(r *Runner) {
+		r.StartupJitter = d
+	}
+}
+
+// JitterBackOff is a constant backoff randomized by up to Jitter in either direction.
+type JitterBackOff struct {
+	Interval time.Duration
+	Jitter   time.Duration
+}
+
+func (b *JitterBackOff) NextBackOff() time.Duration {
+	if b.Jitter <= 0 {
+		return b.Interval
+	}
+	return max(b.Interval+time.Duration(rand.Int64N(int64(2*b.Jitter)))-b.Jitter, 0)
+}
+
+func (b *JitterBackOff) Reset() {}
+
+// ScheduleBackOff waits until the next tick of a cron schedule.
+type ScheduleBackOff struct {
+	Schedule cron.Schedule
+}
+
+// NewScheduleBackOff parses a standard five field cron expression or a
+// descriptor such as @daily.
+func NewScheduleBackOff(expr string) (*ScheduleBackOff, error) {
+	schedule, err := cron.ParseStandard(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &ScheduleBackOff{Schedule: schedule}, nil
+}
+
+func (b *ScheduleBackOff) NextBackOff() time.Duration {
+	return time.Until(b.Schedule.Next(time.Now()))
+}
+
+func (b *ScheduleBackOff) Reset() {}
+
+// Loop runs ReconcileFn until ctx is done. A Trigger cuts any wait short.
 func (r *Runner) Loop(ctx context.Context) {
+	var wait time.Duration
+	if r.WaitFirst {
+		wait = r.nextWait()
+	}
+	if r.StartupJitter > 0 {
+		wait += time.Duration(rand.Int64N(int64(r.StartupJitter)))
+	}
+
 	for {
-		err := r.ReconcileFn(ctx)
+		if !r.sleep(ctx, wait) {
+			return
+		}
+
+		err := r.run(ctx)
+		if ctx.Err() != nil {
+			return
+		}
 		if err != nil {
-			time.Sleep(r.FailBackOff.NextBackOff())
+			wait = r.FailBackOff.NextBackOff()
+			if wait == backoff.Stop {
+				wait = r.nextWait()
+			}
 			continue
 		}
 		r.FailBackOff.Reset()
-		time.Sleep(r.WaitBackOff.NextBackOff())
+		wait = r.nextWait()
 		r.WaitBackOff.Reset()
 	}
 }
 
+// Trigger requests an immediate run. It never blocks; triggers arriving
+// while a run is pending are coalesced.
+func (r *Runner) Trigger() {
+	select {
+	case r.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// State returns a snapshot of the run history.
+func (r *Runner) State() State {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.state
+}
+
+func (r *Runner) run(ctx context.Context) error {
+	start := time.Now()
+	r.mu.Lock()
+	r.state.Running = true
+	r.mu.Unlock()
+
+	err := r.ReconcileFn(ctx)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.state.Running = false
+	r.state.Runs++
+	r.state.LastRun = start
+	r.state.LastDuration = time.Since(start)
+	r.state.LastErr = ""
+	if err != nil {
+		r.state.LastErr = err.Error()
+	}
+	return err
+}
+
+func (r *Runner) nextWait() time.Duration {
+	wait := r.WaitBackOff.NextBackOff()
+	if r.Schedule == nil {
+		return wait
+	}
+	// cron ticks are at least a minute apart, the slack only absorbs the
+	// time passed since the backoff read the clock
+	return time.Until(r.Schedule.Next(time.Now().Add(wait - scheduleSlack)))
+}
+
+// sleep waits d, returning false when ctx is done first.
+func (r *Runner) sleep(ctx context.Context, d time.Duration) bool {
+	r.mu.Lock()
+	r.state.NextRun = time.Now().Add(d)
+	r.mu.Unlock()
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	case <-r.trigger:
+		return true
+	}
+}
+
 func NewRunner(
 	reconcile func(ctx context.Context) error,
 	options ...RunnerOption,
@@ -54,6 +240,7 @@ func NewRunner(
 		WaitBackOff: &backoff.ConstantBackOff{
 			Interval: time.Hour,
 		},
+		trigger: make(chan struct{}, 1),
 	}
 
 	for _, option := range options {
@@ -67,7 +254,8 @@ func RunReconciler(
 	ctx context.Context,
 	reconcile func(ctx context.Context) error,
 	options ...RunnerOption,
-) {
+) *Runner {
 	p := NewRunner(reconcile, options...)
 	go p.Loop(ctx)
+	return p
 }
@@ -0,0 +1,191 @@
+package reconciler
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v5"
+)
+
+// ticks ticks every d from base on.
+type ticks struct {
+	base time.Time
+	d    time.Duration
+}
+
+func (s ticks) Next(t time.Time) time.Time {
+	n := t.Sub(s.base)/s.d + 1
+	if t.Before(s.base) {
+		n = -(s.base.Sub(t) / s.d)
+	}
+	return s.base.Add(n * s.d)
+}
+
+// waitFor polls cond for up to a second.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func start(t *testing.T, r *Runner) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go r.Loop(ctx)
+}
+
+func TestRunnerFirstRun(t *testing.T) {
+	tests := []struct {
+		name      string
+		options   []RunnerOption
+		immediate bool
+	}{
+		{"at startup", nil, true},
+		{"wait first", []RunnerOption{WithWaitFirst(true)}, false},
+		{"startup jitter", []RunnerOption{WithStartupJitter(time.Hour)}, false},
+	}
+	for _, tt := range tests {
+		var runs atomic.Int32
+		r := NewRunner(func(context.Context) error {
+			runs.Add(1)
+			return nil
+		}, append([]RunnerOption{WithInterval(time.Hour, 0)}, tt.options...)...)
+		started := time.Now()
+		start(t, r)
+
+		if tt.immediate {
+			waitFor(t, tt.name+" first run", func() bool { return runs.Load() == 1 })
+			continue
+		}
+		waitFor(t, tt.name+" next run", func() bool { return !r.State().NextRun.IsZero() })
+		if next := r.State().NextRun; next.Before(started) || next.After(started.Add(time.Hour+time.Second)) {
+			t.Errorf("%s: next run at %s, want within an hour", tt.name, next.Sub(started))
+		}
+		time.Sleep(20 * time.Millisecond)
+		if n := runs.Load(); n != 0 {
+			t.Fatalf("%s: %d runs before the first wait passed", tt.name, n)
+		}
+		r.Trigger()
+		waitFor(t, tt.name+" triggered run", func() bool { return runs.Load() == 1 })
+	}
+}
+
+func TestRunnerTriggerCoalesces(t *testing.T) {
+	var runs atomic.Int32
+	release := make(chan struct{})
+	r := NewRunner(func(context.Context) error {
+		if runs.Add(1) == 1 {
+			<-release
+		}
+		return nil
+	}, WithInterval(time.Hour, 0))
+	start(t, r)
+
+	waitFor(t, "first run", func() bool { return r.State().Running })
+	for i := 0; i < 3; i++ {
+		r.Trigger()
+	}
+	close(release)
+
+	waitFor(t, "triggered run", func() bool { return runs.Load() == 2 })
+	time.Sleep(20 * time.Millisecond)
+	if n := runs.Load(); n != 2 {
+		t.Errorf("%d runs, want the triggers during a run coalesced into one", n)
+	}
+}
+
+func TestRunnerState(t *testing.T) {
+	fail := errors.New("source down")
+	var calls atomic.Int32
+	r := NewRunner(func(context.Context) error {
+		if calls.Add(1) == 1 {
+			return fail
+		}
+		return nil
+	}, WithInterval(time.Hour, 0), WithFailBackOff(backoff.NewConstantBackOff(time.Millisecond)))
+	start(t, r)
+
+	waitFor(t, "retry after the failure", func() bool { return r.State().Runs == 2 })
+	st := r.State()
+	if st.Running || st.LastErr != "" || st.LastRun.IsZero() {
+		t.Errorf("state after a successful retry: %+v", st)
+	}
+	if wait := time.Until(st.NextRun); wait < 59*time.Minute {
+		t.Errorf("next run in %s, want the interval after a success", wait)
+	}
+
+	r2 := NewRunner(func(context.Context) error { return fail }, WithFailBackOff(backoff.NewConstantBackOff(time.Hour)))
+	start(t, r2)
+	waitFor(t, "failed run", func() bool { return r2.State().Runs == 1 })
+	if st := r2.State(); st.LastErr != fail.Error() {
+		t.Errorf("last error %q, want %q", st.LastErr, fail)
+	}
+}
+
+func TestRunnerScheduleSlack(t *testing.T) {
+	// the next tick is half an hour away, far from any slack
+	tick := ticks{base: time.Now().Add(30 * time.Minute), d: time.Hour}
+	untilTick := func() time.Duration { return time.Until(tick.Next(time.Now())) }
+	aligned := func(wait time.Duration) bool {
+		off := time.Now().Add(wait).Sub(tick.base) % time.Hour
+		return off > -100*time.Millisecond && off < 100*time.Millisecond ||
+			off > time.Hour-100*time.Millisecond || off < -time.Hour+100*time.Millisecond
+	}
+
+	tests := []struct {
+		name string
+		wait backoff.BackOff
+		// min and max bound the wait in ticks from the next tick on
+		min, max int
+	}{
+		{"no wait", &backoff.ZeroBackOff{}, 0, 0},
+		// the backoff reads the clock a moment before the runner does and
+		// must still land on the tick it computed
+		{"schedule backoff", &ScheduleBackOff{Schedule: tick}, 0, 0},
+		{"stretched by a guard", stretched{&ScheduleBackOff{Schedule: tick}, 3}, 1, 2},
+	}
+	for _, tt := range tests {
+		r := &Runner{Schedule: tick, WaitBackOff: tt.wait}
+		wait := r.nextWait()
+		next := untilTick()
+		if !aligned(wait) {
+			t.Errorf("%s: wait %s is not on a tick", tt.name, wait)
+		}
+		if lo, hi := next+time.Duration(tt.min)*time.Hour, next+time.Duration(tt.max)*time.Hour; wait < lo-time.Second || wait > hi+time.Second {
+			t.Errorf("%s: wait %s, want between %s and %s", tt.name, wait, lo, hi)
+		}
+	}
+}
+
+// stretched multiplies the waits of b.
+type stretched struct {
+	b      backoff.BackOff
+	factor int
+}
+
+func (s stretched) NextBackOff() time.Duration { return s.b.NextBackOff() * time.Duration(s.factor) }
+func (s stretched) Reset()                     {}
+
+func TestJitterBackOff(t *testing.T) {
+	b := &JitterBackOff{Interval: time.Minute, Jitter: 10 * time.Second}
+	for i := 0; i < 100; i++ {
+		if d := b.NextBackOff(); d < 50*time.Second || d >= 70*time.Second {
+			t.Fatalf("wait %s outside 1m±10s", d)
+		}
+	}
+	if d := (&JitterBackOff{Interval: time.Second, Jitter: time.Hour}).NextBackOff(); d < 0 {
+		t.Errorf("negative wait %s", d)
+	}
+	if d := (&JitterBackOff{Interval: time.Minute}).NextBackOff(); d != time.Minute {
+		t.Errorf("wait without jitter %s, want 1m", d)
+	}
+}
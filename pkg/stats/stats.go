@@ -0,0 +1,275 @@
+package stats
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yuridevx/proxylist/pkg/models"
+	"go.uber.org/zap"
+)
+
+// Fetch describes a single provider reconcile.
+type Fetch struct {
+	Provider      string
+	Started       time.Time
+	Duration      time.Duration
+	HTTPStatus    int
+	Err           error `json:"-"`
+	Parsed        int
+	ParseFailures int
+	// Rejected entries parsed fine but fall in a filtered address range.
+	Rejected int
+	// Unchanged fetches found the source as it was and parsed nothing, so
+	// the counts of the last changed fetch are kept.
+	Unchanged bool
+}
+
+// Provider is the in-memory view of a provider since process start.
+type Provider struct {
+	Name      string
+	LastFetch Fetch
+	LastError string
+	UniqueNew int64
+	Checked   int64
+	Passed    int64
+}
+
+type checks struct {
+	uniqueNew int64
+	checked   int64
+	passed    int64
+}
+
+// Collector aggregates provider fetch and check results and periodically
+// writes them to the provider_stats table. A nil Collector ignores all records.
+type Collector struct {
+	db  *pgxpool.Pool
+	log *zap.Logger
+
+	mu        sync.Mutex
+	providers map[string]*Provider
+	fetches   map[string]Fetch
+	pending   map[string]*checks
+	failures  map[string]map[string]int64
+}
+
+func NewCollector(db *pgxpool.Pool, log *zap.Logger) *Collector {
+	return &Collector{
+		db:        db,
+		log:       log,
+		providers: make(map[string]*Provider),
+		fetches:   make(map[string]Fetch),
+		pending:   make(map[string]*checks),
+		failures:  make(map[string]map[string]int64),
+	}
+}
+
+// RecordFetch stores the outcome of a provider reconcile.
+func (c *Collector) RecordFetch(f Fetch) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p := c.provider(f.Provider)
+	if f.Unchanged {
+		f.Parsed = p.LastFetch.Parsed
+		f.ParseFailures = p.LastFetch.ParseFailures
+		f.Rejected = p.LastFetch.Rejected
+	}
+	p.LastFetch = f
+	p.LastError = ""
+	if f.Err != nil {
+		p.LastError = f.Err.Error()
+	}
+	c.fetches[f.Provider] = f
+}
+
+// RecordNew counts an entry the deduplicator has never seen before.
+func (c *Collector) RecordNew(provider string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.provider(provider).UniqueNew++
+	c.checks(provider).uniqueNew++
+}
+
+// RecordCheck counts a finished proxy check.
+func (c *Collector) RecordCheck(provider string, passed bool) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p := c.provider(provider)
+	ch := c.checks(provider)
+	p.Checked++
+	ch.checked++
+	if passed {
+		p.Passed++
+		ch.passed++
+	}
+}
+
+// RecordFailure counts a failed check of protocol by error class.
+func (c *Collector) RecordFailure(protocol, class string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	byClass, ok := c.failures[protocol]
+	if !ok {
+		byClass = make(map[string]int64)
+		c.failures[protocol] = byClass
+	}
+	byClass[class]++
+}
+
+// Failures returns the failed check counts per protocol and error class
+// since process start.
+func (c *Collector) Failures() map[string]map[string]int64 {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	out := make(map[string]map[string]int64, len(c.failures))
+	for protocol, byClass := range c.failures {
+		out[protocol] = make(map[string]int64, len(byClass))
+		for class, n := range byClass {
+			out[protocol][class] = n
+		}
+	}
+	return out
+}
+
+// Snapshot returns a copy of all providers ordered by name.
+func (c *Collector) Snapshot() []Provider {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	list := make([]Provider, 0, len(c.providers))
+	for _, p := range c.providers {
+		list = append(list, *p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Flush writes everything recorded since the last flush to the database.
+// It has the reconcile signature so it can be scheduled by the reconciler.
+// Whatever fails to be written is kept for the next flush.
+func (c *Collector) Flush(ctx context.Context) error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	fetches := c.fetches
+	pending := c.pending
+	c.fetches = make(map[string]Fetch)
+	c.pending = make(map[string]*checks)
+	c.mu.Unlock()
+
+	var lastErr error
+	repo := models.New(c.db)
+	for _, f := range fetches {
+		err := repo.UpsertProviderFetch(ctx, models.UpsertProviderFetchParams{
+			Provider:        f.Provider,
+			LastFetchAt:     pgtype.Timestamp{Time: f.Started, Valid: true},
+			FetchDurationMs: pgtype.Int4{Int32: int32(f.Duration.Milliseconds()), Valid: true},
+			HttpStatus:      pgtype.Int4{Int32: int32(f.HTTPStatus), Valid: f.HTTPStatus != 0},
+			FetchError:      errorText(f.Err),
+			EntriesParsed:   pgtype.Int4{Int32: int32(f.Parsed), Valid: !f.Unchanged},
+			ParseFailures:   pgtype.Int4{Int32: int32(f.ParseFailures), Valid: !f.Unchanged},
+			EntriesRejected: pgtype.Int4{Int32: int32(f.Rejected), Valid: !f.Unchanged},
+		})
+		if err != nil {
+			c.log.Error("failed to store provider fetch", zap.String("provider", f.Provider), zap.Error(err))
+			c.retryFetch(f)
+			lastErr = err
+		}
+	}
+
+	for provider, ch := range pending {
+		err := repo.AddProviderChecks(ctx, models.AddProviderChecksParams{
+			Provider:  provider,
+			UniqueNew: ch.uniqueNew,
+			Checked:   ch.checked,
+			Passed:    ch.passed,
+		})
+		if err != nil {
+			c.log.Error("failed to store provider checks", zap.String("provider", provider), zap.Error(err))
+			c.retryChecks(provider, ch)
+			lastErr = err
+		}
+	}
+
+	return lastErr
+}
+
+// retryFetch puts back a fetch that failed to be written, unless a newer
+// fetch of the provider was recorded meanwhile.
+func (c *Collector) retryFetch(f Fetch) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.fetches[f.Provider]; !ok {
+		c.fetches[f.Provider] = f
+	}
+}
+
+// retryChecks adds counts that failed to be written to the pending ones.
+func (c *Collector) retryChecks(provider string, failed *checks) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch := c.checks(provider)
+	ch.uniqueNew += failed.uniqueNew
+	ch.checked += failed.checked
+	ch.passed += failed.passed
+}
+
+// List returns the persisted statistics of all providers.
+func List(ctx context.Context, db *pgxpool.Pool) ([]models.ProviderStat, error) {
+	return models.New(db).ListProviderStats(ctx)
+}
+
+func (c *Collector) provider(name string) *Provider {
+	p, ok := c.providers[name]
+	if !ok {
+		p = &Provider{Name: name}
+		c.providers[name] = p
+	}
+	return p
+}
+
+func (c *Collector) checks(name string) *checks {
+	ch, ok := c.pending[name]
+	if !ok {
+		ch = &checks{}
+		c.pending[name] = ch
+	}
+	return ch
+}
+
+func errorText(err error) pgtype.Text {
+	if err == nil {
+		return pgtype.Text{}
+	}
+	return pgtype.Text{String: err.Error(), Valid: true}
+}
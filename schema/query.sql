@@ -1,12 +1,35 @@
 -- name: InsertProxyInfoTestResults :exec
-insert into proxy_info (ip, port, protocol, provider, delay_ms, tested_at, websocket, anonymity, item_fetch)
-values ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+-- columns of the tests a profile skipped are NULL and keep their last value,
+-- flagged and flag_reason are only written by SetProxyInfoFlag
+insert into proxy_info (ip, port, protocol, provider, delay_ms, tested_at, websocket, anonymity, item_fetch,
+                        connect_ms, handshake_ms, ttfb_ms, p50_ms, p90_ms, jitter_ms, download_kbytes_s,
+                        upload_kbytes_s, ws_rtt_ms, ws_stability, ws_uptime_s, connect_ports, http2, http3,
+                        remote_dns, dns_leak, profile)
+values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22,
+        $23, $24, $25, $26)
 on conflict (ip, port, protocol) do update
-    set delay_ms   = EXCLUDED.delay_ms,
-        tested_at  = EXCLUDED.tested_at,
-        websocket  = EXCLUDED.websocket,
-        anonymity  = EXCLUDED.anonymity,
-        item_fetch = EXCLUDED.item_fetch;
+    set delay_ms          = EXCLUDED.delay_ms,
+        tested_at         = EXCLUDED.tested_at,
+        websocket         = coalesce(EXCLUDED.websocket, proxy_info.websocket),
+        anonymity         = EXCLUDED.anonymity,
+        item_fetch        = coalesce(EXCLUDED.item_fetch, proxy_info.item_fetch),
+        connect_ms        = coalesce(EXCLUDED.connect_ms, proxy_info.connect_ms),
+        handshake_ms      = coalesce(EXCLUDED.handshake_ms, proxy_info.handshake_ms),
+        ttfb_ms           = coalesce(EXCLUDED.ttfb_ms, proxy_info.ttfb_ms),
+        p50_ms            = coalesce(EXCLUDED.p50_ms, proxy_info.p50_ms),
+        p90_ms            = coalesce(EXCLUDED.p90_ms, proxy_info.p90_ms),
+        jitter_ms         = coalesce(EXCLUDED.jitter_ms, proxy_info.jitter_ms),
+        download_kbytes_s = coalesce(EXCLUDED.download_kbytes_s, proxy_info.download_kbytes_s),
+        upload_kbytes_s   = coalesce(EXCLUDED.upload_kbytes_s, proxy_info.upload_kbytes_s),
+        ws_rtt_ms         = coalesce(EXCLUDED.ws_rtt_ms, proxy_info.ws_rtt_ms),
+        ws_stability      = coalesce(EXCLUDED.ws_stability, proxy_info.ws_stability),
+        ws_uptime_s       = coalesce(EXCLUDED.ws_uptime_s, proxy_info.ws_uptime_s),
+        connect_ports     = coalesce(EXCLUDED.connect_ports, proxy_info.connect_ports),
+        http2             = coalesce(EXCLUDED.http2, proxy_info.http2),
+        http3             = coalesce(EXCLUDED.http3, proxy_info.http3),
+        remote_dns        = coalesce(EXCLUDED.remote_dns, proxy_info.remote_dns),
+        dns_leak          = coalesce(EXCLUDED.dns_leak, proxy_info.dns_leak),
+        profile           = EXCLUDED.profile;
 
 -- name: ProxyInfoWebsocketDisconnect :exec
 update proxy_info
@@ -23,3 +46,60 @@ where ip = $1
   and protocol = $3;
 
 
+
+-- name: SetProxyInfoFlag :exec
+update proxy_info
+set flagged     = $4,
+    flag_reason = $5
+where ip = $1
+  and port = $2
+  and protocol = $3;
+
+-- name: ListHealthyProxies :many
+select ip, port, protocol
+from trusted_proxy_info
+where tested_at > $1
+order by delay_ms
+limit $2;
+
+-- name: DeleteProxyCheckError :exec
+delete
+from proxy_check_error
+where ip = $1
+  and port = $2
+  and protocol = $3;
+
+-- name: UpsertProxyCheckError :exec
+insert into proxy_check_error (ip, port, protocol, provider, error_class, error, tested_at)
+values ($1, $2, $3, $4, $5, $6, $7)
+on conflict (ip, port, protocol) do update
+    set provider    = EXCLUDED.provider,
+        error_class = EXCLUDED.error_class,
+        error       = EXCLUDED.error,
+        tested_at   = EXCLUDED.tested_at;
+
+-- name: UpsertProviderFetch :exec
+insert into provider_stats (provider, last_fetch_at, fetch_duration_ms, http_status, fetch_error, entries_parsed, parse_failures,
+                            entries_rejected)
+values ($1, $2, $3, $4, $5, $6, $7, $8)
+on conflict (provider) do update
+    set last_fetch_at     = EXCLUDED.last_fetch_at,
+        fetch_duration_ms = EXCLUDED.fetch_duration_ms,
+        http_status       = EXCLUDED.http_status,
+        fetch_error       = EXCLUDED.fetch_error,
+        entries_parsed    = coalesce(EXCLUDED.entries_parsed, provider_stats.entries_parsed),
+        parse_failures    = coalesce(EXCLUDED.parse_failures, provider_stats.parse_failures),
+        entries_rejected  = coalesce(EXCLUDED.entries_rejected, provider_stats.entries_rejected);
+
+-- name: AddProviderChecks :exec
+insert into provider_stats (provider, unique_new, checked, passed)
+values ($1, $2, $3, $4)
+on conflict (provider) do update
+    set unique_new = provider_stats.unique_new + EXCLUDED.unique_new,
+        checked    = provider_stats.checked + EXCLUDED.checked,
+        passed     = provider_stats.passed + EXCLUDED.passed;
+
+-- name: ListProviderStats :many
+select *
+from provider_stats
+order by provider;
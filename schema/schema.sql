@@ -1,6 +1,11 @@
 -- drop table proxy_info;
 
-CREATE TABLE proxy_info
+-- every statement is idempotent, so the file also upgrades existing databases
+
+-- recreated below once proxy_info has all its columns
+DROP VIEW IF EXISTS trusted_proxy_info;
+
+CREATE TABLE IF NOT EXISTS proxy_info
 (
     ip                    varchar(39),
     port                  int,
@@ -16,4 +21,91 @@ CREATE TABLE proxy_info
     websocket_error_count int,
 
     primary key (ip, port, protocol)
-);
\ No newline at end of file
+);
+
+-- medians of the latency samples, p50/p90/jitter over total request time
+ALTER TABLE proxy_info
+    ADD COLUMN IF NOT EXISTS connect_ms   int,
+    ADD COLUMN IF NOT EXISTS handshake_ms int,
+    ADD COLUMN IF NOT EXISTS ttfb_ms      int,
+    ADD COLUMN IF NOT EXISTS p50_ms       int,
+    ADD COLUMN IF NOT EXISTS p90_ms       int,
+    ADD COLUMN IF NOT EXISTS jitter_ms    int;
+
+-- throughput in KB/s, replacing the download_kbps/upload_kbps columns
+-- whose unit changed between versions
+ALTER TABLE proxy_info
+    ADD COLUMN IF NOT EXISTS download_kbytes_s int,
+    ADD COLUMN IF NOT EXISTS upload_kbytes_s   int,
+    DROP COLUMN IF EXISTS download_kbps,
+    DROP COLUMN IF EXISTS upload_kbps;
+
+-- long lived websocket session: mean echo rtt, share of echoes answered, seconds kept open
+ALTER TABLE proxy_info
+    ADD COLUMN IF NOT EXISTS ws_rtt_ms    int,
+    ADD COLUMN IF NOT EXISTS ws_stability real,
+    ADD COLUMN IF NOT EXISTS ws_uptime_s  int;
+
+-- ports the proxy tunnels to, null when not tested
+ALTER TABLE proxy_info
+    ADD COLUMN IF NOT EXISTS connect_ports int[];
+
+-- http3 is only tested through socks5 udp relays
+ALTER TABLE proxy_info
+    ADD COLUMN IF NOT EXISTS http2 bool,
+    ADD COLUMN IF NOT EXISTS http3 bool;
+
+ALTER TABLE proxy_info
+    ADD COLUMN IF NOT EXISTS remote_dns bool,
+    ADD COLUMN IF NOT EXISTS dns_leak   bool;
+
+-- honeypot or known bad network, excluded by trusted_proxy_info
+ALTER TABLE proxy_info
+    ADD COLUMN IF NOT EXISTS flagged     bool not null default false,
+    ADD COLUMN IF NOT EXISTS flag_reason varchar;
+
+-- check profile of the last check, null for the full checks
+ALTER TABLE proxy_info
+    ADD COLUMN IF NOT EXISTS profile varchar;
+
+-- the proxies fit for use, every read of proxies to hand out goes through it.
+-- flagged rows stay in proxy_info so a later check can clear the flag
+CREATE VIEW trusted_proxy_info AS
+select *
+from proxy_info
+where not flagged;
+
+-- last failure of every protocol a proxy was checked with
+CREATE TABLE IF NOT EXISTS proxy_check_error
+(
+    ip          varchar(39),
+    port        int,
+    protocol    varchar(10),
+    provider    varchar,
+    error_class varchar(20) not null,
+    error       varchar,
+    tested_at   timestamp,
+
+    primary key (ip, port, protocol)
+);
+
+-- entries_parsed, parse_failures and entries_rejected describe the last fetch
+-- that found the source changed,
+-- unique_new, checked and passed are running totals
+CREATE TABLE IF NOT EXISTS provider_stats
+(
+    provider          varchar primary key,
+    last_fetch_at     timestamp,
+    fetch_duration_ms int,
+    http_status       int,
+    fetch_error       varchar,
+    entries_parsed    int,
+    parse_failures    int,
+
+    unique_new        bigint not null default 0,
+    checked           bigint not null default 0,
+    passed            bigint not null default 0
+);
+
+ALTER TABLE provider_stats
+    ADD COLUMN IF NOT EXISTS entries_rejected int;